@@ -0,0 +1,318 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"slices"
+
+	"github.com/cions/leveldb-cli/indexeddb"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/urfave/cli/v2"
+)
+
+type sizeSummary struct {
+	Total int64 `json:"total"`
+	Min   int   `json:"min"`
+	P50   int   `json:"p50"`
+	P90   int   `json:"p90"`
+	P99   int   `json:"p99"`
+	Max   int   `json:"max"`
+}
+
+// histogramSubBits is the number of bits of precision kept by sizeHistogram.
+// Sizes below 2<<histogramSubBits are counted exactly; larger sizes fall into
+// buckets whose width is at most 1/64 of their lower bound.
+const histogramSubBits = 6
+
+// sizeHistogram records a distribution of sizes in a fixed amount of memory.
+type sizeHistogram struct {
+	counts   [(bits.UintSize - histogramSubBits) << histogramSubBits]int64
+	n        int64
+	total    int64
+	min, max int
+}
+
+func histogramBucket(size int) int {
+	if size < 2<<histogramSubBits {
+		return size
+	}
+	shift := bits.Len(uint(size)) - histogramSubBits - 1
+	return (shift+1)<<histogramSubBits + size>>shift - 1<<histogramSubBits
+}
+
+// histogramUpperBound returns the largest size in the bucket.
+func histogramUpperBound(bucket int) int {
+	if bucket < 2<<histogramSubBits {
+		return bucket
+	}
+	shift := bucket>>histogramSubBits - 1
+	m := bucket&(1<<histogramSubBits-1) + 1<<histogramSubBits
+	return (m+1)<<shift - 1
+}
+
+func (h *sizeHistogram) Add(size int) {
+	if h.n == 0 || size < h.min {
+		h.min = size
+	}
+	if h.n == 0 || size > h.max {
+		h.max = size
+	}
+	h.n++
+	h.total += int64(size)
+	h.counts[histogramBucket(size)]++
+}
+
+// percentile returns the upper bound of the bucket containing the p-th
+// percentile, clamped to the observed range.
+func (h *sizeHistogram) percentile(p int) int {
+	if h.n == 0 {
+		return 0
+	}
+	rank := max((h.n*int64(p)+99)/100, 1)
+	var seen int64
+	for bucket, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			return max(h.min, min(histogramUpperBound(bucket), h.max))
+		}
+	}
+	return h.max
+}
+
+func (h *sizeHistogram) Summary() sizeSummary {
+	return sizeSummary{
+		Total: h.total,
+		Min:   h.min,
+		P50:   h.percentile(50),
+		P90:   h.percentile(90),
+		P99:   h.percentile(99),
+		Max:   h.max,
+	}
+}
+
+type prefixSummary struct {
+	Prefix     string `json:"prefix"`
+	Count      int    `json:"count"`
+	KeyBytes   int64  `json:"keyBytes"`
+	ValueBytes int64  `json:"valueBytes"`
+	DiskSize   int64  `json:"diskSize"`
+	slice      *util.Range
+}
+
+type analysis struct {
+	Entries    int              `json:"entries"`
+	Keys       sizeSummary      `json:"keys"`
+	Values     sizeSummary      `json:"values"`
+	TopByCount []*prefixSummary `json:"topByCount"`
+	TopBySize  []*prefixSummary `json:"topBySize"`
+}
+
+// prefixGrouper returns the group label of a key and the key range of the
+// group. Groups that are not a key range, such as keys without the delimiter,
+// have a nil range.
+type prefixGrouper func(key []byte) (string, *util.Range)
+
+// noDelimiterGroup is the group of keys that do not contain the delimiter.
+const noDelimiterGroup = "(no delimiter)"
+
+func newBytesPrefixGrouper(length int, delimiter []byte) prefixGrouper {
+	return func(key []byte) (string, *util.Range) {
+		prefix := key
+		if len(delimiter) > 0 {
+			i := bytes.Index(key, delimiter)
+			if i < 0 {
+				return noDelimiterGroup, nil
+			}
+			prefix = key[:i+len(delimiter)]
+		} else if len(key) > length {
+			prefix = key[:length]
+		}
+		return string(prefix), util.BytesPrefix(prefix)
+	}
+}
+
+func indexedDBPrefixGrouper(key []byte) (string, *util.Range) {
+	k, err := indexeddb.ParseKey(key)
+	if err != nil {
+		return "invalid", nil
+	}
+	label := fmt.Sprintf("db=%d store=%d index=%d", k.DatabaseId, k.ObjectStoreId, k.IndexId)
+	return label, indexeddb.KeyPrefixRange(k.DatabaseId, k.ObjectStoreId, k.IndexId)
+}
+
+func topPrefixes(prefixes []*prefixSummary, n int, cmpFunc func(a, b *prefixSummary) int) []*prefixSummary {
+	sorted := slices.Clone(prefixes)
+	slices.SortStableFunc(sorted, func(a, b *prefixSummary) int {
+		return -cmpFunc(a, b)
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+func writeSizeSummary(w io.Writer, name string, s sizeSummary) error {
+	_, err := fmt.Fprintf(w, "%-7s total=%d min=%d p50=%d p90=%d p99=%d max=%d\n",
+		name+":", s.Total, s.Min, s.P50, s.P90, s.P99, s.Max)
+	return err
+}
+
+func writePrefixTable(w io.Writer, title string, prefixes []*prefixSummary, indexedDB bool) error {
+	if _, err := fmt.Fprintf(w, "\n%s\n%10s %12s %12s %12s  %s\n", title, "Count", "KeyBytes", "ValueBytes", "DiskSize", "Prefix"); err != nil {
+		return err
+	}
+	for _, p := range prefixes {
+		label := p.Prefix
+		if !indexedDB && p.slice != nil {
+			label = `"` + label + `"`
+		}
+		if _, err := fmt.Fprintf(w, "%10d %12d %12d %12d  %s\n", p.Count, p.KeyBytes, p.ValueBytes, p.DiskSize, label); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func analyzeCmd(c *cli.Context) error {
+	var group prefixGrouper
+	if c.Bool("indexeddb") {
+		group = indexedDBPrefixGrouper
+	} else {
+		delimiter, err := unescape([]byte(c.String("delimiter")))
+		if err != nil {
+			return fmt.Errorf("option --delimiter: %w", err)
+		}
+		if c.Int("prefix-length") < 0 {
+			return fmt.Errorf("option --prefix-length: must not be negative")
+		}
+		group = newBytesPrefixGrouper(c.Int("prefix-length"), delimiter)
+	}
+
+	slice, err := getKeyRange(c)
+	if err != nil {
+		return err
+	}
+
+	comparer, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
+		Comparer:       comparer,
+		ErrorIfMissing: true,
+		ReadOnly:       true,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	s, err := db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer s.Release()
+
+	var entries int
+	var keySizes, valueSizes sizeHistogram
+	groups := make(map[string]*prefixSummary)
+	var prefixes []*prefixSummary
+
+	iter := s.NewIterator(slice, nil)
+	defer iter.Release()
+	for iter.Next() {
+		keySize, valueSize := len(iter.Key()), len(iter.Value())
+		entries++
+		keySizes.Add(keySize)
+		valueSizes.Add(valueSize)
+
+		label, prefixRange := group(iter.Key())
+		p, ok := groups[label]
+		if !ok {
+			p = &prefixSummary{Prefix: label, slice: prefixRange}
+			if !c.Bool("indexeddb") && prefixRange != nil {
+				p.Prefix = escape([]byte(label))
+			}
+			groups[label] = p
+			prefixes = append(prefixes, p)
+		}
+		p.Count++
+		p.KeyBytes += int64(keySize)
+		p.ValueBytes += int64(valueSize)
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	iter.Release()
+	s.Release()
+
+	n := c.Int("top")
+	result := &analysis{
+		Entries: entries,
+		Keys:    keySizes.Summary(),
+		Values:  valueSizes.Summary(),
+		TopByCount: topPrefixes(prefixes, n, func(a, b *prefixSummary) int {
+			return cmp.Compare(a.Count, b.Count)
+		}),
+		TopBySize: topPrefixes(prefixes, n, func(a, b *prefixSummary) int {
+			return cmp.Compare(a.KeyBytes+a.ValueBytes, b.KeyBytes+b.ValueBytes)
+		}),
+	}
+
+	var reported []*prefixSummary
+	var ranges []util.Range
+	for _, p := range slices.Concat(result.TopByCount, result.TopBySize) {
+		if p.slice != nil && !slices.Contains(reported, p) {
+			reported = append(reported, p)
+			ranges = append(ranges, *p.slice)
+		}
+	}
+	sizes, err := db.SizeOf(ranges)
+	if err != nil {
+		return err
+	}
+	for i, p := range reported {
+		p.DiskSize = sizes[i]
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		if _, err := newPrettyPrinter(os.Stdout).WriteJSON(result); err != nil {
+			return err
+		}
+		_, err := os.Stdout.WriteString("\n")
+		return err
+	}
+
+	if _, err := fmt.Printf("Entries: %d\n", result.Entries); err != nil {
+		return err
+	}
+	if err := writeSizeSummary(os.Stdout, "Keys", result.Keys); err != nil {
+		return err
+	}
+	if err := writeSizeSummary(os.Stdout, "Values", result.Values); err != nil {
+		return err
+	}
+	if err := writePrefixTable(os.Stdout, "Top prefixes by count", result.TopByCount, c.Bool("indexeddb")); err != nil {
+		return err
+	}
+	if err := writePrefixTable(os.Stdout, "Top prefixes by size", result.TopBySize, c.Bool("indexeddb")); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSizeHistogram(t *testing.T) {
+	var h sizeHistogram
+	for i := 100; i > 0; i-- {
+		h.Add(i)
+	}
+	got := h.Summary()
+	want := sizeSummary{Total: 5050, Min: 1, P50: 50, P90: 90, P99: 99, Max: 100}
+	if got != want {
+		t.Errorf("Summary() = %+v, want %+v", got, want)
+	}
+
+	h = sizeHistogram{}
+	for i := 1; i <= 1000; i++ {
+		h.Add(i * 1000)
+	}
+	got = h.Summary()
+	for _, tc := range []struct {
+		name      string
+		got, want int
+	}{
+		{"P50", got.P50, 500000},
+		{"P90", got.P90, 900000},
+		{"P99", got.P99, 990000},
+	} {
+		if tc.got < tc.want || tc.got > tc.want+tc.want/64 {
+			t.Errorf("%s = %d, want %d within 1/64", tc.name, tc.got, tc.want)
+		}
+	}
+	if got.Min != 1000 || got.Max != 1000000 {
+		t.Errorf("Min, Max = %d, %d, want 1000, 1000000", got.Min, got.Max)
+	}
+
+	for _, size := range []int{0, 127, 128, 129, 1 << 20, math.MaxInt} {
+		if b := histogramBucket(size); histogramUpperBound(b) < size || (b > 0 && histogramUpperBound(b-1) >= size) {
+			t.Errorf("bucket %d of size %d has bounds (%d, %d]", b, size, histogramUpperBound(b-1), histogramUpperBound(b))
+		}
+	}
+
+	if got := (&sizeHistogram{}).Summary(); got != (sizeSummary{}) {
+		t.Errorf("empty Summary() = %+v, want zero", got)
+	}
+}
+
+func TestBytesPrefixGrouper(t *testing.T) {
+	cases := []struct {
+		length    int
+		delimiter string
+		key       string
+		want      string
+	}{
+		{4, "", "user:1", "user"},
+		{4, "", "ab", "ab"},
+		{4, ":", "user:1", "user:"},
+		{4, ":", "nodelim", noDelimiterGroup},
+	}
+	for _, tc := range cases {
+		group := newBytesPrefixGrouper(tc.length, []byte(tc.delimiter))
+		got, slice := group([]byte(tc.key))
+		if got != tc.want {
+			t.Errorf("group(%q) = %q, want %q", tc.key, got, tc.want)
+		}
+		if tc.want == noDelimiterGroup {
+			if slice != nil {
+				t.Errorf("group(%q) = %v, want nil range", tc.key, slice)
+			}
+		} else if string(slice.Start) != tc.want {
+			t.Errorf("group(%q).Start = %q, want %q", tc.key, slice.Start, tc.want)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/memdb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/urfave/cli/v2"
+)
+
+var byteDecoders = map[string]func([]byte) ([]byte, error){
+	"utf8":   unescape,
+	"base64": decodeBase64,
+	"hex":    decodeHex,
+}
+
+const (
+	batchPut         = "put"
+	batchDelete      = "delete"
+	batchDeleteRange = "delete-range"
+)
+
+// batchOp is an operation of a batch script. For delete-range, Key and Limit
+// are the start (inclusive) and end (exclusive) of the range; a nil Limit
+// extends the range to the end of the database.
+type batchOp struct {
+	Op    string
+	Key   []byte
+	Value []byte
+	Limit []byte
+}
+
+type batchCounts struct {
+	Put          int `json:"put"`
+	Delete       int `json:"delete"`
+	DeleteRange  int `json:"deleteRange"`
+	RangeDeleted int `json:"rangeDeleted"`
+}
+
+func (n *batchCounts) String() string {
+	return fmt.Sprintf("put=%d delete=%d delete-range=%d range-deleted=%d", n.Put, n.Delete, n.DeleteRange, n.RangeDeleted)
+}
+
+// splitBatchLine splits a script line into whitespace-separated fields.
+// Fields may be enclosed in double quotes to include whitespace; the quotes
+// are removed and backslash escapes are left to the argument decoder.
+func splitBatchLine(line string) ([]string, error) {
+	var fields []string
+	for {
+		line = strings.TrimLeft(line, " \t\r")
+		if line == "" {
+			return fields, nil
+		}
+		if line[0] != '"' {
+			end := strings.IndexAny(line, " \t\r")
+			if end < 0 {
+				end = len(line)
+			}
+			fields = append(fields, line[:end])
+			line = line[end:]
+			continue
+		}
+		end := 1
+		for end < len(line) && line[end] != '"' {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(line) {
+			return nil, errors.New("unterminated quoted field")
+		}
+		if end+1 < len(line) && !strings.ContainsRune(" \t\r", rune(line[end+1])) {
+			return nil, errors.New("missing space after quoted field")
+		}
+		fields = append(fields, line[1:end])
+		line = line[end+1:]
+	}
+}
+
+// parseBatchScript parses a line-oriented script of put, delete and
+// delete-range commands. Empty lines and lines starting with # are ignored.
+func parseBatchScript(r io.Reader, decode func([]byte) ([]byte, error)) ([]batchOp, error) {
+	var ops []batchOp
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*opt.MiB)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		if trimmed := strings.TrimSpace(line); trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+		fields, err := splitBatchLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineno, err)
+		}
+		args := make([][]byte, len(fields)-1)
+		for i, field := range fields[1:] {
+			if args[i], err = decode([]byte(field)); err != nil {
+				return nil, fmt.Errorf("line %d: argument %d: %w", lineno, i+1, err)
+			}
+		}
+
+		op := batchOp{Op: fields[0]}
+		switch {
+		case op.Op == batchPut && len(args) == 2:
+			op.Key, op.Value = args[0], args[1]
+		case op.Op == batchDelete && len(args) == 1:
+			op.Key = args[0]
+		case op.Op == batchDeleteRange && (len(args) == 1 || len(args) == 2):
+			op.Key = args[0]
+			if len(args) == 2 {
+				op.Limit = args[1]
+			}
+		case op.Op == batchPut:
+			return nil, fmt.Errorf("line %d: usage: put <key> <value>", lineno)
+		case op.Op == batchDelete:
+			return nil, fmt.Errorf("line %d: usage: delete <key>", lineno)
+		case op.Op == batchDeleteRange:
+			return nil, fmt.Errorf("line %d: usage: delete-range <start> [<end>]", lineno)
+		default:
+			return nil, fmt.Errorf("line %d: unknown command %q", lineno, op.Op)
+		}
+		ops = append(ops, op)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// batchRecord is an operation in JSON Lines format. Op defaults to put, so
+// the output of show --format=jsonl --no-json can be loaded as is and
+// restores the same bytes. Without --no-json, show writes JSON values in
+// compact form and IndexedDB values as plain JSON, and those are stored as
+// such.
+type batchRecord struct {
+	Op    string          `json:"op"`
+	Key   *string         `json:"key"`
+	Value json.RawMessage `json:"value"`
+	Start *string         `json:"start"`
+	End   *string         `json:"end"`
+}
+
+// decodeJSONValue decodes a JSON string with decode, or returns other JSON
+// values in compact form.
+func decodeJSONValue(raw json.RawMessage, decode func([]byte) ([]byte, error)) ([]byte, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return decode([]byte(s))
+	}
+	buf := new(bytes.Buffer)
+	if err := json.Compact(buf, raw); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// parseBatchJSONL parses operations in JSON Lines format.
+func parseBatchJSONL(r io.Reader, decode func([]byte) ([]byte, error)) ([]batchOp, error) {
+	var ops []batchOp
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var rec batchRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("record %d: %w", n, err)
+		}
+
+		str := func(name string, s *string) ([]byte, error) {
+			if s == nil {
+				return nil, fmt.Errorf("record %d: missing %q", n, name)
+			}
+			b, err := decode([]byte(*s))
+			if err != nil {
+				return nil, fmt.Errorf("record %d: %s: %w", n, name, err)
+			}
+			return b, nil
+		}
+
+		op := batchOp{Op: rec.Op}
+		var err error
+		switch op.Op {
+		case "", batchPut:
+			op.Op = batchPut
+			if op.Key, err = str("key", rec.Key); err != nil {
+				return nil, err
+			}
+			if rec.Value == nil {
+				return nil, fmt.Errorf("record %d: missing %q", n, "value")
+			}
+			if op.Value, err = decodeJSONValue(rec.Value, decode); err != nil {
+				return nil, fmt.Errorf("record %d: value: %w", n, err)
+			}
+		case batchDelete:
+			if op.Key, err = str("key", rec.Key); err != nil {
+				return nil, err
+			}
+		case batchDeleteRange:
+			if op.Key, err = str("start", rec.Start); err != nil {
+				return nil, err
+			}
+			if rec.End != nil {
+				if op.Limit, err = str("end", rec.End); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("record %d: unknown op %q", n, op.Op)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// applyBatch applies ops in a single transaction, so that either all or none
+// of them take effect. delete-range sees the effects of preceding operations.
+// If dryRun is true, the effects are only counted with simulateBatch.
+func applyBatch(db *leveldb.DB, cmp comparer.BasicComparer, ops []batchOp, dryRun bool) (*batchCounts, error) {
+	if dryRun {
+		return simulateBatch(db, cmp, ops)
+	}
+
+	tr, err := db.OpenTransaction()
+	if err != nil {
+		return nil, err
+	}
+	defer tr.Discard()
+
+	counts := new(batchCounts)
+	for _, op := range ops {
+		switch op.Op {
+		case batchPut:
+			err = tr.Put(op.Key, op.Value, nil)
+			counts.Put++
+		case batchDelete:
+			err = tr.Delete(op.Key, nil)
+			counts.Delete++
+		case batchDeleteRange:
+			var keys [][]byte
+			iter := tr.NewIterator(&util.Range{Start: op.Key, Limit: op.Limit}, nil)
+			for iter.Next() {
+				keys = append(keys, bytes.Clone(iter.Key()))
+			}
+			iter.Release()
+			if err := iter.Error(); err != nil {
+				return nil, err
+			}
+			for _, key := range keys {
+				if err := tr.Delete(key, nil); err != nil {
+					return nil, err
+				}
+			}
+			counts.DeleteRange++
+			counts.RangeDeleted += len(keys)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tr.Commit(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// simulateBatch counts the effects of ops like applyBatch without writing to
+// db, which may be opened read-only. A discarded transaction is not enough, as
+// opening one flushes the journal to a new table. Puts are kept in memory, and
+// keys deleted from a snapshot of db are tracked in a set.
+func simulateBatch(db *leveldb.DB, cmp comparer.BasicComparer, ops []batchOp) (*batchCounts, error) {
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	puts := memdb.New(cmp, 0)
+	deleted := make(map[string]struct{})
+
+	counts := new(batchCounts)
+	for _, op := range ops {
+		switch op.Op {
+		case batchPut:
+			if err := puts.Put(op.Key, op.Value); err != nil {
+				return nil, err
+			}
+			counts.Put++
+		case batchDelete:
+			puts.Delete(op.Key)
+			deleted[string(op.Key)] = struct{}{}
+			counts.Delete++
+		case batchDeleteRange:
+			slice := &util.Range{Start: op.Key, Limit: op.Limit}
+			iter := snap.NewIterator(slice, nil)
+			for iter.Next() {
+				if _, ok := deleted[string(iter.Key())]; ok || puts.Contains(iter.Key()) {
+					continue
+				}
+				deleted[string(iter.Key())] = struct{}{}
+				counts.RangeDeleted++
+			}
+			iter.Release()
+			if err := iter.Error(); err != nil {
+				return nil, err
+			}
+
+			var keys [][]byte
+			iter = puts.NewIterator(slice)
+			for iter.Next() {
+				keys = append(keys, bytes.Clone(iter.Key()))
+			}
+			iter.Release()
+			for _, key := range keys {
+				puts.Delete(key)
+				deleted[string(key)] = struct{}{}
+			}
+			counts.DeleteRange++
+			counts.RangeDeleted += len(keys)
+		}
+	}
+	return counts, nil
+}
+
+func batchCmd(c *cli.Context) error {
+	var decode func([]byte) ([]byte, error)
+	switch format := c.String("format"); format {
+	case "script":
+		switch {
+		case c.Bool("base64"):
+			decode = decodeBase64
+		case c.Bool("hex"):
+			decode = decodeHex
+		case c.Bool("raw"):
+			decode = func(b []byte) ([]byte, error) { return b, nil }
+		default:
+			decode = unescape
+		}
+	case "jsonl":
+		var ok bool
+		if decode, ok = byteDecoders[c.String("encoding")]; !ok {
+			return fmt.Errorf("option --encoding: unknown encoding %q", c.String("encoding"))
+		}
+	default:
+		return fmt.Errorf("option --format: unknown format %q", format)
+	}
+
+	var r io.Reader = os.Stdin
+	if c.NArg() >= 1 && c.Args().Get(0) != "-" {
+		fh, err := os.Open(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		defer fh.Close()
+		r = fh
+	}
+
+	var ops []batchOp
+	var err error
+	if c.String("format") == "jsonl" {
+		ops, err = parseBatchJSONL(r, decode)
+	} else {
+		ops, err = parseBatchScript(r, decode)
+	}
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("validate") {
+		counts := new(batchCounts)
+		for _, op := range ops {
+			switch op.Op {
+			case batchPut:
+				counts.Put++
+			case batchDelete:
+				counts.Delete++
+			case batchDeleteRange:
+				counts.DeleteRange++
+			}
+		}
+		_, err := fmt.Printf("Valid: put=%d delete=%d delete-range=%d\n", counts.Put, counts.Delete, counts.DeleteRange)
+		return err
+	}
+
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
+		Comparer:       cmp,
+		ErrorIfMissing: true,
+		ReadOnly:       c.Bool("dry-run"),
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	counts, err := applyBatch(db, cmp, ops, c.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	if c.Bool("dry-run") {
+		_, err = fmt.Printf("Would apply: %v\n", counts)
+	} else {
+		_, err = fmt.Printf("Applied: %v\n", counts)
+	}
+	return err
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+)
+
+func TestSplitBatchLine(t *testing.T) {
+	cases := []struct {
+		input string
+		want  string
+		fail  bool
+	}{
+		{`put a b`, `["put" "a" "b"]`, false},
+		{"  put\ta   b  ", `["put" "a" "b"]`, false},
+		{`put "a b" "c\"d"`, `["put" "a b" "c\\\"d"]`, false},
+		{`put "" x`, `["put" "" "x"]`, false},
+		{`put "a`, ``, true},
+		{`put "a"b`, ``, true},
+	}
+
+	for _, tc := range cases {
+		got, err := splitBatchLine(tc.input)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("splitBatchLine(%q) should fail", tc.input)
+			}
+		} else if err != nil {
+			t.Errorf("splitBatchLine(%q): unexpected error: %v", tc.input, err)
+		} else if s := fmt.Sprintf("%q", got); s != tc.want {
+			t.Errorf("splitBatchLine(%q) = %s, want %s", tc.input, s, tc.want)
+		}
+	}
+}
+
+func TestParseBatch(t *testing.T) {
+	script := "# comment\nput k\\x00 \"v 1\"\n\ndelete a\ndelete-range b\ndelete-range c d\n"
+	ops, err := parseBatchScript(strings.NewReader(script), unescape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"put" "k\x00" "v 1" ""} {"delete" "a" "" ""} {"delete-range" "b" "" ""} {"delete-range" "c" "" "d"}]`
+	if got := fmt.Sprintf("%q", ops); got != want {
+		t.Errorf("parseBatchScript() = %s, want %s", got, want)
+	}
+
+	for _, script := range []string{"put a", "delete", "delete-range a b c", "get a", "put \\x a"} {
+		if _, err := parseBatchScript(strings.NewReader(script), unescape); err == nil {
+			t.Errorf("parseBatchScript(%q) should fail", script)
+		}
+	}
+
+	jsonl := `{"key":"k\\0","value":{"a": 1}}` + "\n" +
+		`{"op":"put","key":"s","value":"v\\n"}` + "\n" +
+		`{"op":"delete","key":"a"}` + "\n" +
+		`{"op":"delete-range","start":"b","end":"c"}` + "\n"
+	ops, err = parseBatchJSONL(strings.NewReader(jsonl), unescape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `[{"put" "k\x00" "{\"a\":1}" ""} {"put" "s" "v\n" ""} {"delete" "a" "" ""} {"delete-range" "b" "" "c"}]`
+	if got := fmt.Sprintf("%q", ops); got != want {
+		t.Errorf("parseBatchJSONL() = %s, want %s", got, want)
+	}
+
+	for _, jsonl := range []string{`{"key":"a"}`, `{"op":"delete"}`, `{"op":"get","key":"a"}`, `{`} {
+		if _, err := parseBatchJSONL(strings.NewReader(jsonl), unescape); err == nil {
+			t.Errorf("parseBatchJSONL(%q) should fail", jsonl)
+		}
+	}
+}
+
+func TestBatchJSONLRoundTrip(t *testing.T) {
+	entries := [][2]string{
+		{"bin\x00", "\x00\xff"},
+		{"json", `{"x": 1}`},
+		{"text", "a\nb"},
+		{"replacement\uFFFD", "\xef\xbf\xbd\xef\xbf"},
+	}
+
+	for _, encoding := range []string{"utf8", "base64", "hex"} {
+		buf := new(strings.Builder)
+		w := &jsonlWriter{enc: json.NewEncoder(buf), encode: byteEncodings[encoding]}
+		for _, e := range entries {
+			if err := w.WriteEntry([]byte(e[0]), []byte(e[1])); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ops, err := parseBatchJSONL(strings.NewReader(buf.String()), byteDecoders[encoding])
+		if err != nil {
+			t.Fatalf("%s: parseBatchJSONL(%q): unexpected error: %v", encoding, buf.String(), err)
+		}
+		if len(ops) != len(entries) {
+			t.Fatalf("%s: parseBatchJSONL() returned %d ops, want %d", encoding, len(ops), len(entries))
+		}
+		for i, op := range ops {
+			if string(op.Key) != entries[i][0] || string(op.Value) != entries[i][1] {
+				t.Errorf("%s: op %d = %q %q, want %q %q", encoding, i, op.Key, op.Value, entries[i][0], entries[i][1])
+			}
+		}
+	}
+}
+
+func TestApplyBatch(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "db")
+	db, err := leveldb.OpenFile(dbpath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, key := range []string{"a", "b1", "b2", "c"} {
+		if err := db.Put([]byte(key), []byte("old"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ops, err := parseBatchScript(strings.NewReader("put b3 new\nput d new\ndelete a\ndelete b1\nput b1 x\ndelete-range b c\n"), unescape)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump := func() string {
+		var entries []string
+		iter := db.NewIterator(nil, nil)
+		defer iter.Release()
+		for iter.Next() {
+			entries = append(entries, string(iter.Key())+"="+string(iter.Value()))
+		}
+		return strings.Join(entries, " ")
+	}
+
+	files, err := readDirNames(dbpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, err := applyBatch(db, comparer.DefaultComparer, ops, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "put=3 delete=2 delete-range=1 range-deleted=3"
+	if got := counts.String(); got != want {
+		t.Errorf("applyBatch(dryRun) = %s, want %s", got, want)
+	}
+	if got, want := dump(), "a=old b1=old b2=old c=old"; got != want {
+		t.Errorf("after dry run: %s, want %s", got, want)
+	}
+	if got, err := readDirNames(dbpath); err != nil || !slices.Equal(got, files) {
+		t.Errorf("dry run changed the database files from %q to %q", files, got)
+	}
+
+	counts, err = applyBatch(db, comparer.DefaultComparer, ops, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := counts.String(); got != want {
+		t.Errorf("applyBatch() = %s, want %s", got, want)
+	}
+	if got, want := dump(), "c=old d=new"; got != want {
+		t.Errorf("after applyBatch: %s, want %s", got, want)
+	}
+}
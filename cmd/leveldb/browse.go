@@ -0,0 +1,879 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cions/leveldb-cli/indexeddb"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+// keyListWindow is the number of keys kept loaded on each side of the cursor.
+const keyListWindow = 10000
+
+// searchScanLimit is the number of keys a search examines before it stops
+// and waits for the user to continue it.
+const searchScanLimit = 100000
+
+// keyList is a contiguous part of the keys in a range. It is extended lazily
+// in both directions, so that browsing does not depend on the number of keys.
+type keyList struct {
+	keys    [][]byte
+	fwd     iterator.Iterator // positioned at the last loaded key
+	bwd     iterator.Iterator // positioned at the first loaded key
+	atEnd   bool
+	atStart bool
+}
+
+func newKeyList(r leveldb.Reader, slice *util.Range) *keyList {
+	l := &keyList{
+		fwd: r.NewIterator(slice, nil),
+		bwd: r.NewIterator(slice, nil),
+	}
+	l.Seek(nil)
+	return l
+}
+
+// Seek discards the loaded keys and loads the first key at or after key. If
+// there is no such key, the last key is loaded instead.
+func (l *keyList) Seek(key []byte) {
+	clear(l.keys)
+	l.keys = l.keys[:0]
+	l.atStart, l.atEnd = false, false
+
+	var ok bool
+	if key == nil {
+		ok = l.fwd.First() && l.bwd.First()
+	} else {
+		ok = l.fwd.Seek(key) && l.bwd.Seek(key)
+	}
+	if !ok {
+		l.SeekLast()
+		return
+	}
+	l.keys = append(l.keys, bytes.Clone(l.bwd.Key()))
+}
+
+// SeekLast discards the loaded keys and loads the last key.
+func (l *keyList) SeekLast() {
+	clear(l.keys)
+	l.keys = l.keys[:0]
+	l.atStart, l.atEnd = false, true
+	if !l.bwd.Last() {
+		l.atStart = true
+		return
+	}
+	l.keys = append(l.keys, bytes.Clone(l.bwd.Key()))
+}
+
+// LoadAfter loads up to n keys after the loaded keys, and returns the number
+// of keys loaded.
+func (l *keyList) LoadAfter(n int) int {
+	loaded := 0
+	for loaded < n && !l.atEnd {
+		if !l.fwd.Next() {
+			l.atEnd = true
+			break
+		}
+		l.keys = append(l.keys, bytes.Clone(l.fwd.Key()))
+		loaded++
+	}
+	return loaded
+}
+
+// LoadBefore loads up to n keys before the loaded keys, and returns the
+// number of keys loaded. The indexes of the loaded keys shift by that number.
+func (l *keyList) LoadBefore(n int) int {
+	var keys [][]byte
+	for len(keys) < n && !l.atStart {
+		if !l.bwd.Prev() {
+			l.atStart = true
+			break
+		}
+		keys = append(keys, bytes.Clone(l.bwd.Key()))
+	}
+	slices.Reverse(keys)
+	l.keys = append(keys, l.keys...)
+	return len(keys)
+}
+
+// Trim discards the keys farther than keyListWindow from the i-th key, and
+// returns the new index of the key.
+func (l *keyList) Trim(i int) int {
+	if end := i + keyListWindow; end < len(l.keys) {
+		clear(l.keys[end:])
+		l.keys = l.keys[:end]
+		l.fwd.Seek(l.keys[end-1])
+		l.atEnd = false
+	}
+	if start := i - keyListWindow; start > 0 {
+		clear(l.keys[:start])
+		l.keys = l.keys[start:]
+		l.bwd.Seek(l.keys[0])
+		l.atStart = false
+		i -= start
+	}
+	return i
+}
+
+func (l *keyList) Error() error {
+	if err := l.fwd.Error(); err != nil {
+		return err
+	}
+	return l.bwd.Error()
+}
+
+func (l *keyList) Release() {
+	l.fwd.Release()
+	l.bwd.Release()
+}
+
+// ansiEscapePattern matches the escape sequences written by the color package.
+var ansiEscapePattern = regexp.MustCompile(`\A\x1b\[[0-9;]*[A-Za-z]`)
+
+// isSGRReset reports whether m only turns attributes off. The printers in
+// this package never nest attributes, so it ends all of them.
+func isSGRReset(m string) bool {
+	if !strings.HasSuffix(m, "m") {
+		return false
+	}
+	for _, param := range strings.Split(m[2:len(m)-1], ";") {
+		switch param {
+		case "", "0", "22", "23", "24", "27", "39", "49":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// wrapANSI splits s into lines of at most width runes. Escape sequences do not
+// count towards the width, and colors are carried over to continuation lines.
+func wrapANSI(s string, width int) []string {
+	var lines []string
+	var line strings.Builder
+	var active string
+	n := 0
+	for len(s) > 0 {
+		if m := ansiEscapePattern.FindString(s); m != "" {
+			line.WriteString(m)
+			if isSGRReset(m) {
+				active = ""
+			} else {
+				active += m
+			}
+			s = s[len(m):]
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		s = s[size:]
+		if r == '\n' || n == width {
+			if active != "" {
+				line.WriteString("\x1b[0m")
+			}
+			lines = append(lines, line.String())
+			line.Reset()
+			line.WriteString(active)
+			n = 0
+			if r == '\n' {
+				continue
+			}
+		}
+		line.WriteRune(r)
+		n++
+	}
+	return append(lines, line.String())
+}
+
+// fitANSI truncates or pads s to width runes.
+func fitANSI(s string, width int) string {
+	line := wrapANSI(strings.ReplaceAll(s, "\n", " "), width)[0]
+	visible := utf8.RuneCountInString(stripANSI(line))
+	if strings.Contains(line, "\x1b") {
+		line += "\x1b[0m"
+	}
+	return line + strings.Repeat(" ", max(0, width-visible))
+}
+
+func stripANSI(s string) string {
+	var sb strings.Builder
+	for len(s) > 0 {
+		if m := ansiEscapePattern.FindString(s); m != "" {
+			s = s[len(m):]
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(s)
+		sb.WriteString(s[:size])
+		s = s[size:]
+	}
+	return sb.String()
+}
+
+// browserNode is a node of the IndexedDB tree view.
+type browserNode struct {
+	label string
+	slice *util.Range
+	info  any
+}
+
+func newBrowserTree(dbs []*indexeddb.Database) []browserNode {
+	nodes := []browserNode{{label: "(all keys)"}}
+	for _, db := range dbs {
+		nodes = append(nodes, browserNode{
+			label: fmt.Sprintf("%s (%s)", strconv.Quote(db.Name), db.Origin),
+			slice: &util.Range{
+				Start: indexeddb.KeyPrefixRange(db.Id, 0, 0).Start,
+				Limit: indexeddb.KeyPrefixRange(db.Id+1, 0, 0).Start,
+			},
+			info: db,
+		})
+		for i, store := range db.ObjectStores {
+			branch, indent := "├── ", "│   "
+			if i == len(db.ObjectStores)-1 {
+				branch, indent = "└── ", "    "
+			}
+			nodes = append(nodes, browserNode{
+				label: branch + strconv.Quote(store.Name),
+				slice: indexeddb.ObjectStoreDataRange(db.Id, store.Id),
+				info:  store,
+			})
+			for j, index := range store.Indexes {
+				branch := "├── "
+				if j == len(store.Indexes)-1 {
+					branch = "└── "
+				}
+				nodes = append(nodes, browserNode{
+					label: indent + branch + strconv.Quote(index.Name),
+					slice: indexeddb.KeyPrefixRange(db.Id, store.Id, index.Id),
+					info:  index,
+				})
+			}
+		}
+	}
+	return nodes
+}
+
+const (
+	keyUp rune = -(iota + 1)
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyEscape
+)
+
+const (
+	keyCtrlB     = 0x02
+	keyCtrlC     = 0x03
+	keyCtrlF     = 0x06
+	keyCtrlL     = 0x0c
+	keyEnter     = 0x0d
+	keyBackspace = 0x7f
+)
+
+var browserEscapes = map[string]rune{
+	"\x1b[A":  keyUp,
+	"\x1bOA":  keyUp,
+	"\x1b[B":  keyDown,
+	"\x1bOB":  keyDown,
+	"\x1b[5~": keyPageUp,
+	"\x1b[6~": keyPageDown,
+	"\x1b[H":  keyHome,
+	"\x1bOH":  keyHome,
+	"\x1b[1~": keyHome,
+	"\x1b[F":  keyEnd,
+	"\x1bOF":  keyEnd,
+	"\x1b[4~": keyEnd,
+}
+
+// parseKeys decodes the keys in terminal input. Unknown escape sequences are
+// ignored.
+func parseKeys(b []byte) []rune {
+	var keys []rune
+	for len(b) > 0 {
+		if b[0] == '\x1b' {
+			if len(b) == 1 {
+				keys = append(keys, keyEscape)
+				break
+			}
+			n := 2
+			if b[1] == '[' || b[1] == 'O' {
+				for n < len(b) && (b[n] < 0x40 || b[n] > 0x7e) {
+					n++
+				}
+				n = min(n+1, len(b))
+			}
+			if key, ok := browserEscapes[string(b[:n])]; ok {
+				keys = append(keys, key)
+			}
+			b = b[n:]
+			continue
+		}
+		r, size := utf8.DecodeRune(b)
+		keys = append(keys, r)
+		b = b[size:]
+	}
+	return keys
+}
+
+// browserInput is the line being edited in the status bar.
+type browserInput struct {
+	kind   rune // ':' to jump to a key, '/' to search
+	text   []rune
+	origin []byte
+}
+
+type browser struct {
+	r         leveldb.Reader
+	slice     *util.Range
+	list      *keyList
+	indexedDB bool
+
+	cursor, top   int
+	width, height int
+
+	hexdump  bool
+	value    []string
+	valueTop int
+
+	tree       []browserNode
+	treeMode   bool
+	treeCursor int
+	treeTop    int
+
+	input   *browserInput
+	pattern *regexp.Regexp
+	message string
+	quit    bool
+
+	// scanLimit is the number of keys a search examines before it stops.
+	// resume is the key to continue an unfinished search from, in the
+	// direction given by resumeBackward.
+	scanLimit      int
+	resume         []byte
+	resumeBackward bool
+}
+
+func newBrowser(r leveldb.Reader, slice *util.Range, indexedDB bool) (*browser, error) {
+	b := &browser{
+		r:         r,
+		slice:     slice,
+		list:      newKeyList(r, slice),
+		indexedDB: indexedDB,
+		width:     80,
+		height:    24,
+		scanLimit: searchScanLimit,
+	}
+	if indexedDB {
+		dbs, err := indexeddb.ReadSchema(r)
+		if err != nil {
+			return nil, err
+		}
+		b.tree = newBrowserTree(dbs)
+		b.tree[0].slice = slice
+	}
+	b.setCursor(0)
+	return b, nil
+}
+
+func (b *browser) Release() {
+	b.list.Release()
+}
+
+func (b *browser) SetSize(width, height int) {
+	if width != b.width || height != b.height {
+		b.width, b.height = width, height
+		b.value = nil
+		b.setCursor(b.cursor)
+		b.setTreeCursor(b.treeCursor)
+	}
+}
+
+func (b *browser) paneHeight() int {
+	return max(1, b.height-1)
+}
+
+func (b *browser) leftWidth() int {
+	return max(1, b.width*2/5)
+}
+
+func (b *browser) rightWidth() int {
+	return max(1, b.width-b.leftWidth()-1)
+}
+
+// key returns the key at the cursor, or nil if there are no keys.
+func (b *browser) key() []byte {
+	if b.cursor < len(b.list.keys) {
+		return b.list.keys[b.cursor]
+	}
+	return nil
+}
+
+func (b *browser) keyText(key []byte) string {
+	if b.indexedDB {
+		if k, err := indexeddb.ParseKey(key); err == nil {
+			return k.String()
+		}
+	}
+	return escape(key)
+}
+
+func (b *browser) setCursor(i int) {
+	l := b.list
+	if len(l.keys) == 0 {
+		b.cursor, b.top = 0, 0
+		b.value = nil
+		return
+	}
+	prev := b.key()
+	i = max(0, min(i, len(l.keys)-1))
+	if trimmed := l.Trim(i); trimmed != i {
+		b.top -= i - trimmed
+		i = trimmed
+	}
+	b.cursor = i
+
+	ph := b.paneHeight()
+	if b.cursor < b.top {
+		b.top = b.cursor
+	} else if b.cursor >= b.top+ph {
+		b.top = b.cursor - ph + 1
+	}
+	b.top = max(0, b.top)
+	if need := b.top + ph - len(l.keys); need > 0 {
+		l.LoadAfter(need)
+	}
+	if l.atEnd && b.top+ph > len(l.keys) {
+		b.top = max(0, len(l.keys)-ph)
+	}
+
+	if !bytes.Equal(prev, b.key()) || prev == nil {
+		b.value = nil
+		b.valueTop = 0
+	}
+}
+
+// setTreeCursor moves the cursor of the tree view to i, scrolling to keep it
+// visible.
+func (b *browser) setTreeCursor(i int) {
+	b.treeCursor = max(0, min(i, len(b.tree)-1))
+	ph := b.paneHeight()
+	if b.treeCursor < b.treeTop {
+		b.treeTop = b.treeCursor
+	} else if b.treeCursor >= b.treeTop+ph {
+		b.treeTop = b.treeCursor - ph + 1
+	}
+}
+
+// move moves the cursor by delta, loading keys as needed.
+func (b *browser) move(delta int) {
+	i := b.cursor + delta
+	if n := i - len(b.list.keys) + 1; n > 0 {
+		b.list.LoadAfter(n)
+	}
+	if i < 0 {
+		n := b.list.LoadBefore(-i)
+		b.cursor += n
+		b.top += n
+		i += n
+	}
+	b.setCursor(i)
+}
+
+// jump moves the cursor to the first key at or after key, with some keys
+// before it loaded for context.
+func (b *browser) jump(key []byte) {
+	b.list.Seek(key)
+	n := b.list.LoadBefore(b.paneHeight() / 2)
+	b.top = 0
+	b.cursor = n
+	b.value = nil
+	b.setCursor(n)
+}
+
+func (b *browser) jumpLast() {
+	b.list.SeekLast()
+	n := b.list.LoadBefore(b.paneHeight() - 1)
+	b.top = 0
+	b.value = nil
+	b.setCursor(n)
+}
+
+// search finds the first key matching the pattern after (or before, if
+// backward is true) from. If inclusive is true, from itself may match. To keep
+// the screen responsive, search gives up after examining scanLimit keys and
+// records where to resume in b.resume.
+func (b *browser) search(from []byte, backward, inclusive bool) (bool, error) {
+	b.resume = nil
+	if b.pattern == nil {
+		return false, nil
+	}
+	iter := b.r.NewIterator(b.slice, nil)
+	defer iter.Release()
+
+	ok := iter.Seek(from)
+	if backward {
+		if !ok {
+			ok = iter.Last()
+		} else if !inclusive || !bytes.Equal(iter.Key(), from) {
+			ok = iter.Prev()
+		}
+	} else if ok && !inclusive && bytes.Equal(iter.Key(), from) {
+		ok = iter.Next()
+	}
+	for n := 0; ok; n++ {
+		if n == b.scanLimit {
+			b.resume = bytes.Clone(iter.Key())
+			b.resumeBackward = backward
+			return false, nil
+		}
+		if b.pattern.MatchString(b.keyText(iter.Key())) {
+			b.jump(iter.Key())
+			return true, nil
+		}
+		if backward {
+			ok = iter.Prev()
+		} else {
+			ok = iter.Next()
+		}
+	}
+	return false, iter.Error()
+}
+
+func (b *browser) setScope(slice *util.Range) {
+	b.list.Release()
+	b.slice = slice
+	b.list = newKeyList(b.r, slice)
+	b.top = 0
+	b.value = nil
+	b.setCursor(0)
+}
+
+// HandleKey processes a key press.
+func (b *browser) HandleKey(key rune) error {
+	if b.input != nil {
+		return b.handleInput(key)
+	}
+	b.message = ""
+	if key != 'n' && key != 'N' {
+		b.resume = nil
+	}
+
+	if b.treeMode {
+		switch key {
+		case 'j', keyDown:
+			b.setTreeCursor(b.treeCursor + 1)
+		case 'k', keyUp:
+			b.setTreeCursor(b.treeCursor - 1)
+		case keyEnter:
+			b.setScope(b.tree[b.treeCursor].slice)
+			b.treeMode = false
+		case 't', keyEscape:
+			b.treeMode = false
+		case 'q', keyCtrlC:
+			b.quit = true
+		}
+		b.value = nil
+		b.valueTop = 0
+		return nil
+	}
+
+	ph := b.paneHeight()
+	switch key {
+	case 'q', keyCtrlC:
+		b.quit = true
+	case 'j', keyDown:
+		b.move(1)
+	case 'k', keyUp:
+		b.move(-1)
+	case ' ', keyCtrlF, keyPageDown:
+		b.top += ph
+		b.move(ph)
+	case keyCtrlB, keyPageUp:
+		b.top -= ph
+		if b.top < 0 {
+			n := b.list.LoadBefore(-b.top)
+			b.top += n
+			b.cursor += n
+		}
+		b.move(-ph)
+	case 'g', keyHome:
+		b.jump(nil)
+	case 'G', keyEnd:
+		b.jumpLast()
+	case 'J':
+		b.valueTop = min(b.valueTop+1, max(0, len(b.value)-ph))
+	case 'K':
+		b.valueTop = max(b.valueTop-1, 0)
+	case 'x':
+		b.hexdump = !b.hexdump
+		b.value = nil
+		b.valueTop = 0
+	case 't':
+		if b.tree == nil {
+			b.message = "not an IndexedDB database"
+		} else {
+			b.treeMode = true
+			b.value = nil
+			b.valueTop = 0
+		}
+	case ':', '/':
+		b.input = &browserInput{kind: key, origin: bytes.Clone(b.key())}
+	case 'n', 'N':
+		backward := key == 'N'
+		from, inclusive := b.key(), false
+		if b.resume != nil && b.resumeBackward == backward {
+			from, inclusive = b.resume, true
+		}
+		found, err := b.search(from, backward, inclusive)
+		if err != nil {
+			return err
+		}
+		if b.resume != nil {
+			b.message = fmt.Sprintf("searching… press %c to continue", key)
+		} else if !found && b.pattern != nil {
+			b.message = "pattern not found: " + b.pattern.String()
+		}
+	}
+	return b.list.Error()
+}
+
+func (b *browser) handleInput(key rune) error {
+	in := b.input
+	switch key {
+	case keyEnter:
+		b.input = nil
+		return nil
+	case keyEscape, keyCtrlC:
+		b.input = nil
+		b.resume = nil
+		b.jump(in.origin)
+		return nil
+	case keyBackspace, '\b':
+		if len(in.text) == 0 {
+			return nil
+		}
+		in.text = in.text[:len(in.text)-1]
+	default:
+		if key < 0x20 {
+			return nil
+		}
+		in.text = append(in.text, key)
+	}
+
+	b.message = ""
+	text := string(in.text)
+	switch in.kind {
+	case ':':
+		k, err := unescape([]byte(text))
+		if err != nil {
+			b.message = err.Error()
+			return nil
+		}
+		b.jump(k)
+	case '/':
+		pattern, err := regexp.Compile(text)
+		if err != nil {
+			b.message = "invalid pattern"
+			return nil
+		}
+		b.pattern = pattern
+		found, err := b.search(in.origin, false, true)
+		if err != nil {
+			return err
+		}
+		if b.resume != nil {
+			b.message = "searching… press Enter, then n to continue"
+		} else if !found {
+			b.message = "pattern not found"
+		}
+	}
+	return b.list.Error()
+}
+
+func (b *browser) renderValue() []string {
+	buf := new(bytes.Buffer)
+	if b.treeMode {
+		if info := b.tree[b.treeCursor].info; info != nil {
+			newPrettyPrinter(buf).WriteJSON(info)
+		}
+		return wrapANSI(buf.String(), b.rightWidth())
+	}
+
+	key := b.key()
+	if key == nil {
+		return nil
+	}
+	value, err := b.r.Get(key, nil)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	if b.hexdump {
+		newHexdumpWriter(buf).Write(value)
+		return wrapANSI(buf.String(), b.rightWidth())
+	}
+	if b.indexedDB {
+		if obj, err := decodeIndexedDBValue(key, value); err == nil {
+			newPrettyPrinter(buf).WriteJSON(obj)
+			return wrapANSI(buf.String(), b.rightWidth())
+		}
+	}
+	newPrettyPrinter(buf).SetParseJSON(true).Write(value)
+	return wrapANSI(buf.String(), b.rightWidth())
+}
+
+// Render returns the lines of the screen.
+func (b *browser) Render() []string {
+	if b.value == nil {
+		b.value = b.renderValue()
+	}
+
+	ph, lw, rw := b.paneHeight(), b.leftWidth(), b.rightWidth()
+	lines := make([]string, 0, ph+1)
+	for i := range ph {
+		var left string
+		if b.treeMode {
+			if j := b.treeTop + i; j < len(b.tree) {
+				left = fitANSI(b.tree[j].label, lw)
+				if j == b.treeCursor {
+					left = "\x1b[7m" + left + "\x1b[0m"
+				}
+			} else {
+				left = strings.Repeat(" ", lw)
+			}
+		} else if j := b.top + i; j < len(b.list.keys) {
+			left = fitANSI(b.keyText(b.list.keys[j]), lw)
+			if j == b.cursor {
+				left = "\x1b[7m" + left + "\x1b[0m"
+			}
+		} else {
+			left = strings.Repeat(" ", lw)
+		}
+
+		right := ""
+		if j := b.valueTop + i; j < len(b.value) {
+			right = b.value[j]
+		}
+		lines = append(lines, left+"│"+fitANSI(right, rw))
+	}
+
+	var status string
+	switch {
+	case b.input != nil:
+		status = string(b.input.kind) + string(b.input.text) + "_"
+	case b.message != "":
+		status = b.message
+	case b.treeMode:
+		status = "j/k:move  enter:select  t:back  q:quit"
+	default:
+		status = "j/k:move  g/G:first/last  ::jump  /:search  n/N:next/prev  J/K:scroll  x:hexdump  t:tree  q:quit"
+	}
+	lines = append(lines, "\x1b[7m"+fitANSI(status, b.width)+"\x1b[0m")
+	return lines
+}
+
+func (b *browser) draw(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	for i, line := range b.Render() {
+		fmt.Fprintf(buf, "\x1b[%d;1H%s\x1b[K", i+1, line)
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func browseCmd(c *cli.Context) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("browse requires a terminal")
+	}
+
+	slice, err := getKeyRange(c)
+	if err != nil {
+		return err
+	}
+
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
+		Comparer:       cmp,
+		ErrorIfMissing: true,
+		ReadOnly:       true,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	s, err := db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer s.Release()
+
+	b, err := newBrowser(s, slice, c.Bool("indexeddb"))
+	if err != nil {
+		return err
+	}
+	defer b.Release()
+	b.hexdump = c.Bool("hexdump")
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	defer os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+
+	buf := make([]byte, 256)
+	for !b.quit {
+		if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+			b.SetSize(width, height)
+		}
+		if err := b.draw(os.Stdout); err != nil {
+			return err
+		}
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			if key == keyCtrlL {
+				os.Stdout.WriteString("\x1b[2J")
+				continue
+			}
+			if err := b.HandleKey(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	b.Release()
+	s.Release()
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
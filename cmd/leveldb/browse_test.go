@@ -0,0 +1,254 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func newTestBrowserDB(t *testing.T, n int) *leveldb.DB {
+	db, err := leveldb.OpenFile(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for i := range n {
+		key := fmt.Sprintf("key%03d", i)
+		if err := db.Put([]byte(key), []byte(`{"n":`+fmt.Sprint(i)+`}`), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestKeyList(t *testing.T) {
+	db := newTestBrowserDB(t, 100)
+	l := newKeyList(db, nil)
+	defer l.Release()
+
+	keys := func() string {
+		var s []string
+		for _, k := range l.keys {
+			s = append(s, string(k))
+		}
+		return strings.Join(s, " ")
+	}
+
+	if got := l.LoadAfter(2); got != 2 || keys() != "key000 key001 key002" {
+		t.Errorf("LoadAfter(2) = %d, keys = %s", got, keys())
+	}
+	if got := l.LoadBefore(2); got != 0 || !l.atStart {
+		t.Errorf("LoadBefore(2) at start = %d", got)
+	}
+
+	l.Seek([]byte("key050"))
+	if got := l.LoadBefore(2); got != 2 || keys() != "key048 key049 key050" {
+		t.Errorf("LoadBefore(2) = %d, keys = %s", got, keys())
+	}
+	l.LoadAfter(1)
+	if got := keys(); got != "key048 key049 key050 key051" {
+		t.Errorf("LoadAfter(1): keys = %s", got)
+	}
+
+	l.Seek([]byte("zzz"))
+	if got := keys(); got != "key099" || !l.atEnd {
+		t.Errorf("Seek(past end): keys = %s", got)
+	}
+	if got := l.LoadBefore(1); got != 1 || keys() != "key098 key099" {
+		t.Errorf("LoadBefore(1) = %d, keys = %s", got, keys())
+	}
+
+	empty := newKeyList(db, &util.Range{Start: []byte("a"), Limit: []byte("b")})
+	defer empty.Release()
+	if len(empty.keys) != 0 || !empty.atStart || !empty.atEnd {
+		t.Errorf("empty range: keys = %q", empty.keys)
+	}
+}
+
+func TestWrapANSI(t *testing.T) {
+	cases := []struct {
+		input string
+		width int
+		want  string
+	}{
+		{"abcdef", 4, `["abcd" "ef"]`},
+		{"ab\ncd", 4, `["ab" "cd"]`},
+		{"abcd\nef", 4, `["abcd" "ef"]`},
+		{"a\x1b[2mbcd\x1b[22mef", 3, `["a\x1b[2mbc\x1b[0m" "\x1b[2md\x1b[22mef"]`},
+		{"", 4, `[""]`},
+	}
+	for _, tc := range cases {
+		if got := fmt.Sprintf("%q", wrapANSI(tc.input, tc.width)); got != tc.want {
+			t.Errorf("wrapANSI(%q, %d) = %s, want %s", tc.input, tc.width, got, tc.want)
+		}
+	}
+
+	if got, want := fitANSI("a\x1b[2mb\x1b[22m", 4), "a\x1b[2mb\x1b[22m\x1b[0m  "; got != want {
+		t.Errorf("fitANSI() = %q, want %q", got, want)
+	}
+	if got, want := fitANSI("abcdef", 4), "abcd"; got != want {
+		t.Errorf("fitANSI() = %q, want %q", got, want)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("j\x1b[A\x1b[6~\x1b[1;5Cé\r\x1b"))
+	want := []rune{'j', keyUp, keyPageDown, 'é', keyEnter, keyEscape}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("parseKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestBrowser(t *testing.T) {
+	db := newTestBrowserDB(t, 100)
+	b, err := newBrowser(db, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Release()
+	b.SetSize(40, 6)
+
+	press := func(keys ...rune) {
+		t.Helper()
+		for _, key := range keys {
+			if err := b.HandleKey(key); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	current := func() string {
+		return string(b.key())
+	}
+
+	press('j', 'j', keyDown)
+	if got := current(); got != "key003" {
+		t.Errorf("after moving down: %s", got)
+	}
+	press(keyPageDown)
+	if got := current(); got != "key008" {
+		t.Errorf("after page down: %s", got)
+	}
+	press('G')
+	if got := current(); got != "key099" {
+		t.Errorf("after G: %s", got)
+	}
+	press(keyPageUp, 'k')
+	if got := current(); got != "key093" {
+		t.Errorf("after page up: %s", got)
+	}
+
+	press(':', 'k', 'e', 'y', '0', '4')
+	if got := current(); got != "key040" {
+		t.Errorf("after jump: %s", got)
+	}
+	press(keyEnter, 'k')
+	if got := current(); got != "key039" {
+		t.Errorf("after moving up from jump: %s", got)
+	}
+
+	press('/', '5', '$')
+	if got := current(); got != "key045" {
+		t.Errorf("after search: %s", got)
+	}
+	press(keyEnter, 'n')
+	if got := current(); got != "key055" {
+		t.Errorf("after n: %s", got)
+	}
+	press('N', 'N')
+	if got := current(); got != "key035" {
+		t.Errorf("after N: %s", got)
+	}
+	press('/', 'x', keyEscape)
+	if got := current(); got != "key035" {
+		t.Errorf("after cancelled search: %s", got)
+	}
+
+	lines := b.Render()
+	if len(lines) != 6 {
+		t.Fatalf("Render() returned %d lines", len(lines))
+	}
+	for i, line := range lines {
+		if n := len([]rune(stripANSI(line))); n != 40 {
+			t.Errorf("line %d has width %d: %q", i, n, stripANSI(line))
+		}
+	}
+	if got := stripANSI(lines[0]); !strings.Contains(got, "key033") || !strings.Contains(got, "{") {
+		t.Errorf("Render()[0] = %q", got)
+	}
+
+	press('x')
+	if got := stripANSI(b.Render()[0]); !strings.Contains(got, "00000000: 7b22") {
+		t.Errorf("Render()[0] with hexdump = %q", got)
+	}
+
+	press('t')
+	if b.treeMode || b.message == "" {
+		t.Error("tree view should not be available")
+	}
+
+	b.tree = make([]browserNode, 20)
+	for i := range b.tree {
+		b.tree[i].label = fmt.Sprintf("node%02d", i)
+	}
+	press('t')
+	for range 7 {
+		press('j')
+	}
+	lines = b.Render()
+	if got := stripANSI(lines[0]); !strings.HasPrefix(got, "node03") {
+		t.Errorf("tree Render()[0] = %q, want node03", got)
+	}
+	if got := stripANSI(lines[4]); !strings.HasPrefix(got, "node07") || !strings.Contains(lines[4], "\x1b[7mnode07") {
+		t.Errorf("tree Render()[4] = %q, want node07 highlighted", lines[4])
+	}
+	for range 30 {
+		press('j')
+	}
+	if got := stripANSI(b.Render()[4]); b.treeCursor != 19 || !strings.HasPrefix(got, "node19") {
+		t.Errorf("at the last node: cursor = %d, Render()[4] = %q", b.treeCursor, got)
+	}
+	for range 17 {
+		press('k')
+	}
+	if got := stripANSI(b.Render()[0]); !strings.HasPrefix(got, "node02") {
+		t.Errorf("after moving up: Render()[0] = %q, want node02", got)
+	}
+}
+
+func TestBrowserSearchLimit(t *testing.T) {
+	db := newTestBrowserDB(t, 100)
+	b, err := newBrowser(db, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Release()
+	b.scanLimit = 10
+
+	for _, key := range []rune{'/', '9', '9', keyEnter} {
+		if err := b.HandleKey(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// "9" matches key009, but "99" is not found within the first 10 keys.
+	for i := range 8 {
+		if got := string(b.key()); got != "key009" || !strings.HasPrefix(b.message, "searching") {
+			t.Fatalf("after %d continuations: key = %s, message = %q", i, got, b.message)
+		}
+		if err := b.HandleKey('n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.HandleKey('n'); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b.key()); got != "key099" || b.message != "" {
+		t.Errorf("after continuing: key = %s, message = %q", got, b.message)
+	}
+}
@@ -0,0 +1,677 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cions/leveldb-cli/indexeddb"
+	"github.com/golang/snappy"
+	"github.com/urfave/cli/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+)
+
+var (
+	errTrailingData = errors.New("trailing data after value")
+	errInvalidCBOR  = errors.New("invalid CBOR data")
+	errInvalidBSON  = errors.New("invalid BSON document")
+	errTooDeep      = errors.New("value nested too deeply")
+	errTooLarge     = fmt.Errorf("decompressed value exceeds %d bytes", maxDecompressedSize)
+)
+
+// maxNestingDepth limits the nesting of arrays and maps in decoded values.
+const maxNestingDepth = 512
+
+// maxDecompressedSize limits the size of a decompressed value, so that a
+// small value cannot expand to exhaust memory.
+const maxDecompressedSize = 64 << 20
+
+// maxAutoLayers limits the number of compression layers unwrapped by the
+// auto codec.
+const maxAutoLayers = 8
+
+var (
+	gzipMagic         = []byte{0x1f, 0x8b}
+	snappyFramedMagic = []byte("\xff\x06\x00\x00sNaPpY")
+	cborSelfDescribe  = []byte{0xd9, 0xd9, 0xf7}
+)
+
+// valueCodec is a value decoder. Exactly one of decompress and decode is set:
+// decompress unwraps a compression layer and decode parses structured data.
+type valueCodec struct {
+	decompress func([]byte) ([]byte, error)
+	decode     func([]byte) (any, error)
+}
+
+var valueCodecs = map[string]valueCodec{
+	"gzip":    {decompress: decompressGzip},
+	"zlib":    {decompress: decompressZlib},
+	"snappy":  {decompress: decompressSnappy},
+	"msgpack": {decode: decodeMsgpack},
+	"cbor":    {decode: decodeCBOR},
+	"bson":    {decode: decodeBSON},
+}
+
+// codecChain is a list of codec names applied to values in order. The name
+// "auto" detects compression layers and structured formats by magic bytes.
+type codecChain []string
+
+func parseCodecChain(s string) (codecChain, error) {
+	var chain codecChain
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if len(chain) > 0 {
+			if last := chain[len(chain)-1]; last == "auto" || valueCodecs[last].decode != nil {
+				return nil, fmt.Errorf("%s must be the last codec", last)
+			}
+		}
+		if _, ok := valueCodecs[name]; !ok && name != "auto" {
+			names := []string{"auto"}
+			for name := range valueCodecs {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			return nil, fmt.Errorf("unknown codec %q (supported: %s)", name, strings.Join(names, ", "))
+		}
+		chain = append(chain, name)
+	}
+	return chain, nil
+}
+
+// newCodecChain returns the codecChain given by --value-codec, or nil if the
+// option is not given.
+func newCodecChain(c *cli.Context) (codecChain, error) {
+	chain, err := parseCodecChain(c.String("value-codec"))
+	if err != nil {
+		return nil, fmt.Errorf("option --value-codec: %w", err)
+	}
+	return chain, nil
+}
+
+// Decode applies the codecs to b. If the chain ends with a structured format,
+// the decoded value is returned as JSON; otherwise the decompressed bytes are
+// returned.
+func (chain codecChain) Decode(b []byte) ([]byte, json.RawMessage, error) {
+	var obj any
+	structured := false
+	for _, name := range chain {
+		var err error
+		if name == "auto" {
+			b, obj, err = autoDecode(b)
+			structured = obj != nil
+		} else if codec := valueCodecs[name]; codec.decompress != nil {
+			b, err = codec.decompress(b)
+		} else {
+			obj, err = codec.decode(b)
+			structured = true
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if !structured {
+		return b, nil, nil
+	}
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, raw, nil
+}
+
+func sniffCompression(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, gzipMagic):
+		return "gzip"
+	case bytes.HasPrefix(b, snappyFramedMagic):
+		return "snappy"
+	case len(b) >= 2 && b[0]&0x0f == 8 && b[0]>>4 <= 7 && b[1]&0x20 == 0 && binary.BigEndian.Uint16(b)%31 == 0:
+		return "zlib"
+	default:
+		return ""
+	}
+}
+
+func isMsgpackContainer(c byte) bool {
+	return 0x80 <= c && c <= 0x9f || 0xdc <= c && c <= 0xdf
+}
+
+func isCBORContainer(c byte) bool {
+	return 0x80 <= c && c <= 0xbf
+}
+
+// autoDecode unwraps compression layers detected by magic bytes, then tries
+// the structured formats. Snappy is only detected in the framing format, as
+// the block format has no magic bytes. msgpack and CBOR have no magic bytes
+// either and are only tried when the value is a map or an array that spans
+// the whole input. If nothing matches, the input is returned as is.
+func autoDecode(b []byte) ([]byte, any, error) {
+	for range maxAutoLayers {
+		name := sniffCompression(b)
+		if name == "" {
+			break
+		}
+		decompressed, err := valueCodecs[name].decompress(b)
+		if err != nil {
+			break
+		}
+		b = decompressed
+	}
+
+	if isBSONDocument(b) {
+		if obj, err := decodeBSON(b); err == nil {
+			return b, obj, nil
+		}
+	}
+	if bytes.HasPrefix(b, cborSelfDescribe) {
+		if obj, err := decodeCBOR(b); err == nil {
+			return b, obj, nil
+		}
+	}
+	if len(b) > 0 && isMsgpackContainer(b[0]) {
+		if obj, err := decodeMsgpack(b); err == nil {
+			return b, obj, nil
+		}
+	}
+	if len(b) > 0 && isCBORContainer(b[0]) {
+		if obj, err := decodeCBOR(b); err == nil {
+			return b, obj, nil
+		}
+	}
+	return b, nil, nil
+}
+
+// readAllLimited reads r to the end, failing if it yields more than
+// maxDecompressedSize bytes.
+func readAllLimited(r io.Reader) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxDecompressedSize {
+		return nil, errTooLarge
+	}
+	return b, nil
+}
+
+func decompressGzip(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readAllLimited(r)
+}
+
+func decompressZlib(b []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readAllLimited(r)
+}
+
+// decompressSnappy decompresses both the snappy framing format and the raw
+// block format.
+func decompressSnappy(b []byte) ([]byte, error) {
+	if bytes.HasPrefix(b, snappyFramedMagic) {
+		return readAllLimited(snappy.NewReader(bytes.NewReader(b)))
+	}
+	n, err := snappy.DecodedLen(b)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxDecompressedSize {
+		return nil, errTooLarge
+	}
+	return snappy.Decode(nil, b)
+}
+
+// mapKeyString converts a map key to a JSON object key. Byte strings are
+// base64-encoded like byte string values.
+func mapKeyString(k any) string {
+	switch k := k.(type) {
+	case string:
+		return k
+	case []byte:
+		return base64.StdEncoding.EncodeToString(k)
+	}
+	if b, err := json.Marshal(k); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(k)
+}
+
+// decodeMsgpackValue decodes arrays and maps itself to limit their nesting,
+// and leaves other values to the library.
+func decodeMsgpackValue(dec *msgpack.Decoder, depth int) (any, error) {
+	if depth > maxNestingDepth {
+		return nil, errTooDeep
+	}
+	c, err := dec.PeekCode()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case msgpcode.IsFixedArray(c) || c == msgpcode.Array16 || c == msgpcode.Array32:
+		n, err := dec.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+		arr := make([]any, 0, min(n, 1024))
+		for range n {
+			v, err := decodeMsgpackValue(dec, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case msgpcode.IsFixedMap(c) || c == msgpcode.Map16 || c == msgpcode.Map32:
+		n, err := dec.DecodeMapLen()
+		if err != nil {
+			return nil, err
+		}
+		obj := indexeddb.Object{}
+		for range n {
+			k, err := decodeMsgpackValue(dec, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := decodeMsgpackValue(dec, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, indexeddb.Property{Key: mapKeyString(k), Value: v})
+		}
+		return obj, nil
+	}
+	return dec.DecodeInterface()
+}
+
+// decodeMsgpack decodes a msgpack value. Maps keep their key order.
+func decodeMsgpack(b []byte) (any, error) {
+	r := bytes.NewReader(b)
+	dec := msgpack.NewDecoder(r)
+	v, err := decodeMsgpackValue(dec, 0)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() > 0 {
+		return nil, errTrailingData
+	}
+	return v, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// decodeCBOR decodes a CBOR (RFC 8949) value. Maps keep their key order,
+// bignums are decoded as *big.Int and other tags are dropped.
+func decodeCBOR(b []byte) (any, error) {
+	d := &cborDecoder{data: b}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos < len(d.data) {
+		return nil, errTrailingData
+	}
+	return v, nil
+}
+
+func (d *cborDecoder) read(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// head reads the initial byte and argument of a data item. For indefinite
+// lengths, info is 31 and arg is 0.
+func (d *cborDecoder) head() (major, info byte, arg uint64, err error) {
+	b, err := d.read(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = b[0]>>5, b[0]&0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		b, err := d.read(1 << (info - 24))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		for _, c := range b {
+			arg = arg<<8 | uint64(c)
+		}
+	case info == 31 && major >= 2 && major != 6:
+	default:
+		return 0, 0, 0, errInvalidCBOR
+	}
+	return major, info, arg, nil
+}
+
+func (d *cborDecoder) isBreak() bool {
+	if d.pos < len(d.data) && d.data[d.pos] == 0xff {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+func (d *cborDecoder) value(depth int) (any, error) {
+	if depth > maxNestingDepth {
+		return nil, errInvalidCBOR
+	}
+	major, info, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		return arg, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			n := new(big.Int).SetUint64(arg)
+			return n.Not(n), nil
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		var b []byte
+		if info == 31 {
+			b = []byte{}
+			for !d.isBreak() {
+				m, i, n, err := d.head()
+				if err != nil {
+					return nil, err
+				}
+				if m != major || i == 31 {
+					return nil, errInvalidCBOR
+				}
+				chunk, err := d.read(n)
+				if err != nil {
+					return nil, err
+				}
+				b = append(b, chunk...)
+			}
+		} else if b, err = d.read(arg); err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			return string(b), nil
+		}
+		return bytes.Clone(b), nil
+	case 4:
+		arr := []any{}
+		for i := uint64(0); info == 31 && !d.isBreak() || info != 31 && i < arg; i++ {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case 5:
+		obj := indexeddb.Object{}
+		for i := uint64(0); info == 31 && !d.isBreak() || info != 31 && i < arg; i++ {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, indexeddb.Property{Key: mapKeyString(k), Value: v})
+		}
+		return obj, nil
+	case 6:
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := v.([]byte); ok && (arg == 2 || arg == 3) {
+			n := new(big.Int).SetBytes(b)
+			if arg == 3 {
+				n.Not(n)
+			}
+			return n, nil
+		}
+		return v, nil
+	default:
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 25:
+			return halfToFloat64(uint16(arg)), nil
+		case 26:
+			return float64(math.Float32frombits(uint32(arg))), nil
+		case 27:
+			return math.Float64frombits(arg), nil
+		case 31:
+			return nil, errInvalidCBOR
+		default:
+			return fmt.Sprintf("simple(%d)", arg), nil
+		}
+	}
+}
+
+func halfToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
+
+// isBSONDocument reports whether b is framed like a BSON document.
+func isBSONDocument(b []byte) bool {
+	return len(b) >= 5 && int(binary.LittleEndian.Uint32(b)) == len(b) && b[len(b)-1] == 0
+}
+
+// decodeBSON decodes a BSON document. Types without a JSON counterpart are
+// represented as in MongoDB Extended JSON.
+func decodeBSON(b []byte) (any, error) {
+	if !isBSONDocument(b) {
+		return nil, errInvalidBSON
+	}
+	return decodeBSONDocument(b, false, 0)
+}
+
+func readCString(b []byte) (string, []byte, error) {
+	i := bytes.IndexByte(b, 0)
+	if i < 0 {
+		return "", nil, errInvalidBSON
+	}
+	return string(b[:i]), b[i+1:], nil
+}
+
+// readBSONFrame splits off a value prefixed by an int32 length. extra is the
+// number of bytes not counted by the length: 0 for documents, 4 for strings
+// and 5 for binary data.
+func readBSONFrame(b []byte, extra int) ([]byte, []byte, error) {
+	if len(b) < 4 {
+		return nil, nil, errInvalidBSON
+	}
+	size := int64(int32(binary.LittleEndian.Uint32(b))) + int64(extra)
+	if size < 5 || size > int64(len(b)) {
+		return nil, nil, errInvalidBSON
+	}
+	return b[:size], b[size:], nil
+}
+
+func decodeBSONDocument(b []byte, array bool, depth int) (any, error) {
+	if depth > maxNestingDepth || len(b) < 5 || b[len(b)-1] != 0 {
+		return nil, errInvalidBSON
+	}
+	body := b[4 : len(b)-1]
+	obj := indexeddb.Object{}
+	for len(body) > 0 {
+		typ := body[0]
+		name, rest, err := readCString(body[1:])
+		if err != nil {
+			return nil, err
+		}
+		var v any
+		if v, body, err = decodeBSONValue(typ, rest, depth); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		obj = append(obj, indexeddb.Property{Key: name, Value: v})
+	}
+	if array {
+		arr := make([]any, len(obj))
+		for i, prop := range obj {
+			arr[i] = prop.Value
+		}
+		return arr, nil
+	}
+	return obj, nil
+}
+
+func fixedBSON(b []byte, n int) ([]byte, []byte, error) {
+	if len(b) < n {
+		return nil, nil, errInvalidBSON
+	}
+	return b[:n], b[n:], nil
+}
+
+func decodeBSONString(b []byte) (string, []byte, error) {
+	s, rest, err := readBSONFrame(b, 4)
+	if err != nil || s[len(s)-1] != 0 {
+		return "", nil, errInvalidBSON
+	}
+	return string(s[4 : len(s)-1]), rest, nil
+}
+
+func decodeBSONValue(typ byte, b []byte, depth int) (any, []byte, error) {
+	switch typ {
+	case 0x01:
+		v, rest, err := fixedBSON(b, 8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(v)), rest, nil
+	case 0x02, 0x0d, 0x0e:
+		return decodeBSONString(b)
+	case 0x03, 0x04:
+		doc, rest, err := readBSONFrame(b, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		v, err := decodeBSONDocument(doc, typ == 0x04, depth+1)
+		return v, rest, err
+	case 0x05:
+		v, rest, err := readBSONFrame(b, 5)
+		if err != nil {
+			return nil, nil, err
+		}
+		if subtype := v[4]; subtype != 0x00 {
+			return indexeddb.Object{{Key: "$binary", Value: indexeddb.Object{
+				{Key: "base64", Value: v[5:]},
+				{Key: "subType", Value: fmt.Sprintf("%02x", subtype)},
+			}}}, rest, nil
+		}
+		return bytes.Clone(v[5:]), rest, nil
+	case 0x06, 0x0a:
+		return nil, b, nil
+	case 0x07:
+		v, rest, err := fixedBSON(b, 12)
+		if err != nil {
+			return nil, nil, err
+		}
+		return indexeddb.Object{{Key: "$oid", Value: hex.EncodeToString(v)}}, rest, nil
+	case 0x08:
+		v, rest, err := fixedBSON(b, 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return v[0] != 0, rest, nil
+	case 0x09:
+		v, rest, err := fixedBSON(b, 8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return time.UnixMilli(int64(binary.LittleEndian.Uint64(v))).UTC(), rest, nil
+	case 0x0b:
+		pattern, rest, err := readCString(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		flags, rest, err := readCString(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		return indexeddb.RegExp{Pattern: pattern, Flags: flags}, rest, nil
+	case 0x10:
+		v, rest, err := fixedBSON(b, 4)
+		if err != nil {
+			return nil, nil, err
+		}
+		return int32(binary.LittleEndian.Uint32(v)), rest, nil
+	case 0x11:
+		v, rest, err := fixedBSON(b, 8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return indexeddb.Object{{Key: "$timestamp", Value: indexeddb.Object{
+			{Key: "t", Value: binary.LittleEndian.Uint32(v[4:])},
+			{Key: "i", Value: binary.LittleEndian.Uint32(v)},
+		}}}, rest, nil
+	case 0x12:
+		v, rest, err := fixedBSON(b, 8)
+		if err != nil {
+			return nil, nil, err
+		}
+		return int64(binary.LittleEndian.Uint64(v)), rest, nil
+	case 0xff:
+		return indexeddb.Object{{Key: "$minKey", Value: 1}}, b, nil
+	case 0x7f:
+		return indexeddb.Object{{Key: "$maxKey", Value: 1}}, b, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported BSON type 0x%02x", typ)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zlibBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := zlib.NewWriter(buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func snappyFramedBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := snappy.NewBufferedWriter(buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseCodecChain(t *testing.T) {
+	cases := []struct {
+		input string
+		want  codecChain
+		fail  bool
+	}{
+		{"", nil, false},
+		{"msgpack", codecChain{"msgpack"}, false},
+		{"snappy, msgpack", codecChain{"snappy", "msgpack"}, false},
+		{"gzip,auto", codecChain{"gzip", "auto"}, false},
+		{"msgpack,gzip", nil, true},
+		{"auto,bson", nil, true},
+		{"xml", nil, true},
+	}
+
+	for _, tc := range cases {
+		got, err := parseCodecChain(tc.input)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("parseCodecChain(%q) should fail", tc.input)
+			}
+		} else if err != nil {
+			t.Errorf("parseCodecChain(%q): unexpected error: %v", tc.input, err)
+		} else if !slices.Equal(got, tc.want) {
+			t.Errorf("parseCodecChain(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestCodecChainDecode(t *testing.T) {
+	msgpackValue, err := msgpack.Marshal(map[string]any{"b": []int{1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// {"z": 1, "a": [-2, "x", 1.5, true, null, h'0102']}
+	cborValue := []byte("\xa2\x61z\x01\x61a\x86\x21\x61x\xf9\x3e\x00\xf5\xf6\x42\x01\x02")
+	// {"n": int32(7), "s": "hi", "d": {"t": true}}
+	bsonValue := []byte("\x22\x00\x00\x00" +
+		"\x10n\x00\x07\x00\x00\x00" +
+		"\x02s\x00\x03\x00\x00\x00hi\x00" +
+		"\x03d\x00\x09\x00\x00\x00\x08t\x00\x01\x00" +
+		"\x00")
+	jsonValue := []byte(`{"k":"v"}`)
+
+	cases := []struct {
+		chain     string
+		input     []byte
+		wantBytes []byte
+		wantJSON  string
+		fail      bool
+	}{
+		{"msgpack", msgpackValue, nil, `{"b":[1,2]}`, false},
+		{"cbor", cborValue, nil, `{"z":1,"a":[-2,"x",1.5,true,null,"AQI="]}`, false},
+		{"bson", bsonValue, nil, `{"n":7,"s":"hi","d":{"t":true}}`, false},
+		{"gzip", gzipBytes(t, jsonValue), jsonValue, "", false},
+		{"zlib", zlibBytes(t, jsonValue), jsonValue, "", false},
+		{"snappy", snappy.Encode(nil, jsonValue), jsonValue, "", false},
+		{"snappy,msgpack", snappy.Encode(nil, msgpackValue), nil, `{"b":[1,2]}`, false},
+		{"gzip,cbor", gzipBytes(t, cborValue), nil, `{"z":1,"a":[-2,"x",1.5,true,null,"AQI="]}`, false},
+		{"auto", gzipBytes(t, zlibBytes(t, bsonValue)), nil, `{"n":7,"s":"hi","d":{"t":true}}`, false},
+		{"auto", snappyFramedBytes(t, msgpackValue), nil, `{"b":[1,2]}`, false},
+		{"auto", append([]byte("\xd9\xd9\xf7"), cborValue...), nil, `{"z":1,"a":[-2,"x",1.5,true,null,"AQI="]}`, false},
+		{"auto", jsonValue, jsonValue, "", false},
+		{"auto", []byte("plain text"), []byte("plain text"), "", false},
+		{"gzip", jsonValue, nil, "", true},
+		{"msgpack", append(msgpackValue, 0), nil, "", true},
+		{"cbor", cborValue[:len(cborValue)-1], nil, "", true},
+		{"bson", bsonValue[:len(bsonValue)-1], nil, "", true},
+	}
+
+	for _, tc := range cases {
+		chain, err := parseCodecChain(tc.chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, obj, err := chain.Decode(tc.input)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("%s: Decode(%q) should fail", tc.chain, tc.input)
+			}
+		} else if err != nil {
+			t.Errorf("%s: Decode(%q): unexpected error: %v", tc.chain, tc.input, err)
+		} else if tc.wantJSON != "" && string(obj) != tc.wantJSON {
+			t.Errorf("%s: Decode(%q) = %s, want %s", tc.chain, tc.input, obj, tc.wantJSON)
+		} else if tc.wantJSON == "" && (obj != nil || !bytes.Equal(b, tc.wantBytes)) {
+			t.Errorf("%s: Decode(%q) = %q, %s, want %q", tc.chain, tc.input, b, obj, tc.wantBytes)
+		}
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	large := make([]byte, maxDecompressedSize+1)
+	// A snappy block header claiming 2 GiB of output, with no data.
+	snappyHeader := []byte{0x80, 0x80, 0x80, 0x80, 0x08}
+
+	cases := []struct {
+		chain string
+		input []byte
+	}{
+		{"gzip", gzipBytes(t, large)},
+		{"zlib", zlibBytes(t, large)},
+		{"snappy", snappyFramedBytes(t, large)},
+		{"snappy", snappy.Encode(nil, large)},
+		{"snappy", snappyHeader},
+	}
+	for _, tc := range cases {
+		chain, err := parseCodecChain(tc.chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := chain.Decode(tc.input); !errors.Is(err, errTooLarge) {
+			t.Errorf("%s: Decode(%d bytes): got error %v, want errTooLarge", tc.chain, len(tc.input), err)
+		}
+	}
+
+	chain, err := parseCodecChain("auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := gzipBytes(t, large)
+	if b, _, err := chain.Decode(input); err != nil || !bytes.Equal(b, input) {
+		t.Errorf("auto: Decode(%d bytes) = %d bytes, %v, want the input as is", len(input), len(b), err)
+	}
+}
+
+func TestDecodeDepthLimit(t *testing.T) {
+	deep := append(bytes.Repeat([]byte{0x91}, 3<<20), 0xc0)
+	if _, err := decodeMsgpack(deep); !errors.Is(err, errTooDeep) {
+		t.Errorf("decodeMsgpack(deeply nested arrays): got error %v, want errTooDeep", err)
+	}
+	deep = append(bytes.Repeat([]byte{0x81, 0xa1, 'k'}, 3<<20), 0xc0)
+	if _, err := decodeMsgpack(deep); !errors.Is(err, errTooDeep) {
+		t.Errorf("decodeMsgpack(deeply nested maps): got error %v, want errTooDeep", err)
+	}
+
+	nested := append(bytes.Repeat([]byte{0x91}, maxNestingDepth), 0xc0)
+	if _, err := decodeMsgpack(nested); err != nil {
+		t.Errorf("decodeMsgpack(%d nested arrays): unexpected error: %v", maxNestingDepth, err)
+	}
+
+	chain, err := parseCodecChain("auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deep = append(bytes.Repeat([]byte{0x91}, 3<<20), 0xc0)
+	if b, obj, err := chain.Decode(deep); err != nil || obj != nil || len(b) != len(deep) {
+		t.Errorf("auto: Decode(deeply nested arrays) = %d bytes, %s, %v, want the input as is", len(b), obj, err)
+	}
+}
+
+func TestPrettyPrinterCodec(t *testing.T) {
+	chain, err := parseCodecChain("snappy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	w := newPrettyPrinter(buf).SetParseJSON(true).SetColor(false).SetCodec(chain)
+	if _, err := w.Write(snappy.Encode(nil, []byte(`{"key":"value"}`))); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"key\": \"value\"\n}"; buf.String() != want {
+		t.Errorf("Write() = %q, want %q", buf.String(), want)
+	}
+}
@@ -4,12 +4,14 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"github.com/cions/leveldb-cli/indexeddb"
 	"github.com/fatih/color"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 	"github.com/urfave/cli/v2"
@@ -17,26 +19,19 @@ import (
 	"io"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
+	"runtime"
 )
 
 var leveldbFilenamePattern = regexp.MustCompile(`\A(?:LOCK|LOG(?:\.old)?|CURRENT(?:\.bak|\.\d+)?|MANIFEST-\d+|\d+\.(?:ldb|log|sst|tmp))\z`)
 
-type entry struct {
-	Key, Value []byte
-}
-
-func getComparer(c *cli.Context) comparer.Comparer {
-	if c.Bool("indexeddb") {
-		return indexeddb.Comparer
-	}
-	return comparer.DefaultComparer
-}
-
 func getArg(c *cli.Context, n int) ([]byte, error) {
 	arg := []byte(c.Args().Get(n))
 	if c.Bool("base64") {
 		return decodeBase64(arg)
+	} else if c.Bool("hex") {
+		return decodeHex(arg)
 	} else if c.Bool("raw") {
 		return arg, nil
 	} else {
@@ -44,19 +39,35 @@ func getArg(c *cli.Context, n int) ([]byte, error) {
 	}
 }
 
+// getKeyArg is like getArg, but prepends the current prefix of the shell.
+func getKeyArg(c *cli.Context, n int) ([]byte, error) {
+	key, err := getArg(c, n)
+	if err != nil {
+		return nil, err
+	}
+	if s := shellSessionOf(c); s != nil && len(s.prefix) > 0 {
+		key = append(bytes.Clone(s.prefix), key...)
+	}
+	return key, nil
+}
+
+var keyRangeFlagNames = []string{
+	"start",
+	"start-raw",
+	"start-base64",
+	"start-hex",
+	"end",
+	"end-raw",
+	"end-base64",
+	"end-hex",
+	"prefix",
+	"prefix-raw",
+	"prefix-base64",
+	"prefix-hex",
+}
+
 func hasKeyRange(c *cli.Context) bool {
-	flagNames := []string{
-		"start",
-		"start-raw",
-		"start-base64",
-		"end",
-		"end-raw",
-		"end-base64",
-		"prefix",
-		"prefix-raw",
-		"prefix-base64",
-	}
-	for _, flagName := range flagNames {
+	for _, flagName := range keyRangeFlagNames {
 		if c.IsSet(flagName) {
 			return true
 		}
@@ -64,33 +75,41 @@ func hasKeyRange(c *cli.Context) bool {
 	return false
 }
 
+func prefixRange(prefix []byte, indexedDB bool) *util.Range {
+	if indexedDB {
+		return indexeddb.Prefix(prefix)
+	}
+	return util.BytesPrefix(prefix)
+}
+
 func getKeyRange(c *cli.Context) (*util.Range, error) {
+	if s := shellSessionOf(c); s != nil && s.scope != nil && !hasKeyRange(c) {
+		return s.scope, nil
+	}
 	if c.IsSet("prefix-base64") {
 		prefix, err := decodeBase64([]byte(c.String("prefix-base64")))
 		if err != nil {
 			return nil, fmt.Errorf("option --prefix-base64: %w", err)
 		}
-		if c.Bool("indexeddb") {
-			return indexeddb.Prefix(prefix), nil
+		return prefixRange(prefix, c.Bool("indexeddb")), nil
+	}
+	if c.IsSet("prefix-hex") {
+		prefix, err := decodeHex([]byte(c.String("prefix-hex")))
+		if err != nil {
+			return nil, fmt.Errorf("option --prefix-hex: %w", err)
 		}
-		return util.BytesPrefix(prefix), nil
+		return prefixRange(prefix, c.Bool("indexeddb")), nil
 	}
 	if c.IsSet("prefix-raw") {
 		prefix := []byte(c.String("prefix-raw"))
-		if c.Bool("indexeddb") {
-			return indexeddb.Prefix(prefix), nil
-		}
-		return util.BytesPrefix(prefix), nil
+		return prefixRange(prefix, c.Bool("indexeddb")), nil
 	}
 	if c.IsSet("prefix") {
 		prefix, err := unescape([]byte(c.String("prefix")))
 		if err != nil {
 			return nil, fmt.Errorf("option --prefix: %w", err)
 		}
-		if c.Bool("indexeddb") {
-			return indexeddb.Prefix(prefix), nil
-		}
-		return util.BytesPrefix(prefix), nil
+		return prefixRange(prefix, c.Bool("indexeddb")), nil
 	}
 
 	slice := &util.Range{}
@@ -101,6 +120,12 @@ func getKeyRange(c *cli.Context) (*util.Range, error) {
 			return nil, fmt.Errorf("option --start-base64: %w", err)
 		}
 		slice.Start = start
+	} else if c.IsSet("start-hex") {
+		start, err := decodeHex([]byte(c.String("start-hex")))
+		if err != nil {
+			return nil, fmt.Errorf("option --start-hex: %w", err)
+		}
+		slice.Start = start
 	} else if c.IsSet("start-raw") {
 		slice.Start = []byte(c.String("start-raw"))
 	} else if c.IsSet("start") {
@@ -117,6 +142,12 @@ func getKeyRange(c *cli.Context) (*util.Range, error) {
 			return nil, fmt.Errorf("option --end-base64: %w", err)
 		}
 		slice.Limit = end
+	} else if c.IsSet("end-hex") {
+		end, err := decodeHex([]byte(c.String("end-hex")))
+		if err != nil {
+			return nil, fmt.Errorf("option --end-hex: %w", err)
+		}
+		slice.Limit = end
 	} else if c.IsSet("end-raw") {
 		slice.Limit = []byte(c.String("end-raw"))
 	} else if c.IsSet("end") {
@@ -178,9 +209,47 @@ func newRegexpMatcher(patterns ...string) (regexpMatcher, error) {
 	return matcher, nil
 }
 
+// dbHandle is the subset of the methods of *leveldb.DB and
+// *leveldb.Transaction used by the get, put, delete, keys and show commands.
+type dbHandle interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+	Put(key, value []byte, wo *opt.WriteOptions) error
+	Write(batch *leveldb.Batch, wo *opt.WriteOptions) error
+}
+
+// openDB opens the database for the get, put, delete, keys and show commands.
+// In the shell, it returns the database or the transaction of the session
+// instead, and closing it does nothing.
+func openDB(c *cli.Context, readOnly bool) (dbHandle, func() error, error) {
+	if s := shellSessionOf(c); s != nil {
+		return s.handle(), func() error { return nil }, nil
+	}
+
+	cmp, err := getComparer(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
+		Comparer:       cmp,
+		ErrorIfMissing: true,
+		ReadOnly:       readOnly,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, db.Close, nil
+}
+
 func initCmd(c *cli.Context) error {
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
 	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
-		Comparer:     getComparer(c),
+		Comparer:     cmp,
 		ErrorIfExist: true,
 	})
 	if err != nil {
@@ -194,33 +263,59 @@ func initCmd(c *cli.Context) error {
 
 func getCmd(c *cli.Context) error {
 	if c.NArg() < 1 {
-		cli.ShowSubcommandHelpAndExit(c, 2)
+		return usageError(c)
 	}
 
-	key, err := getArg(c, 0)
+	key, err := getKeyArg(c, 0)
 	if err != nil {
 		return err
 	}
 
-	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
-		Comparer:       getComparer(c),
-		ErrorIfMissing: true,
-		ReadOnly:       true,
-	})
+	pd, err := newProtoDecoder(c)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	codec, err := newCodecChain(c)
+	if err != nil {
+		return err
+	}
+
+	db, closeDB, err := openDB(c, true)
+	if err != nil {
+		return err
+	}
+	defer closeDB()
 
 	value, err := db.Get(key, nil)
 	if err != nil {
 		return err
 	}
-	if _, err := os.Stdout.Write(value); err != nil {
+	if c.Bool("hexdump") {
+		if _, err := newHexdumpWriter(color.Output).Write(value); err != nil {
+			return err
+		}
+		if len(value) > 0 {
+			if _, err := os.Stdout.WriteString("\n"); err != nil {
+				return err
+			}
+		}
+	} else if pd != nil || codec != nil {
+		if _, err := newPrettyPrinter(color.Output).SetProtobuf(pd).SetCodec(codec).Write(value); err != nil {
+			return err
+		}
+		if _, err := os.Stdout.WriteString("\n"); err != nil {
+			return err
+		}
+	} else if _, err := os.Stdout.Write(value); err != nil {
 		return err
+	} else if shellSessionOf(c) != nil && !bytes.HasSuffix(value, []byte("\n")) {
+		// Keep the prompt of the shell at the beginning of a line.
+		if _, err := os.Stdout.WriteString("\n"); err != nil {
+			return err
+		}
 	}
 
-	if err := db.Close(); err != nil {
+	if err := closeDB(); err != nil {
 		return err
 	}
 
@@ -228,11 +323,13 @@ func getCmd(c *cli.Context) error {
 }
 
 func putCmd(c *cli.Context) error {
-	if c.NArg() < 1 {
-		cli.ShowSubcommandHelpAndExit(c, 2)
+	// The shell reads commands from the standard input, so it cannot be used
+	// for values.
+	if c.NArg() < 1 || (c.NArg() < 2 && shellSessionOf(c) != nil) {
+		return usageError(c)
 	}
 
-	key, err := getArg(c, 0)
+	key, err := getKeyArg(c, 0)
 	if err != nil {
 		return err
 	}
@@ -247,20 +344,17 @@ func putCmd(c *cli.Context) error {
 		return err
 	}
 
-	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
-		Comparer:       getComparer(c),
-		ErrorIfMissing: true,
-	})
+	db, closeDB, err := openDB(c, false)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	defer closeDB()
 
 	if err := db.Put(key, value, nil); err != nil {
 		return err
 	}
 
-	if err := db.Close(); err != nil {
+	if err := closeDB(); err != nil {
 		return err
 	}
 
@@ -268,8 +362,8 @@ func putCmd(c *cli.Context) error {
 }
 
 func deleteCmd(c *cli.Context) error {
-	if !hasKeyRange(c) && c.NArg() == 0 {
-		cli.ShowSubcommandHelpAndExit(c, 2)
+	if !hasKeyRange(c) && c.NArg() == 0 && !c.IsSet("where") {
+		return usageError(c)
 	}
 
 	slice, err := getKeyRange(c)
@@ -279,6 +373,17 @@ func deleteCmd(c *cli.Context) error {
 	inverted := c.Bool("invert-match")
 	dryRun := c.Bool("dry-run")
 	keywriter := newPrettyPrinter(color.Output).SetQuoting(true)
+	jw, err := newJSONLWriter(c, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if jw != nil && !dryRun {
+		return fmt.Errorf("option --format=jsonl can only be used with --dry-run")
+	}
+	filter, err := newValueFilter(c)
+	if err != nil {
+		return err
+	}
 
 	var m matcher
 	if c.NArg() == 0 {
@@ -291,7 +396,7 @@ func deleteCmd(c *cli.Context) error {
 	} else {
 		keys := make([][]byte, c.NArg())
 		for i := range c.NArg() {
-			key, err := getArg(c, i)
+			key, err := getKeyArg(c, i)
 			if err != nil {
 				return err
 			}
@@ -300,29 +405,28 @@ func deleteCmd(c *cli.Context) error {
 		m = newLiteralMatcher(keys...)
 	}
 
-	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
-		Comparer:       getComparer(c),
-		ErrorIfMissing: true,
-		ReadOnly:       dryRun,
-	})
+	db, closeDB, err := openDB(c, dryRun)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-
-	s, err := db.GetSnapshot()
-	if err != nil {
-		return err
-	}
-	defer s.Release()
+	defer closeDB()
 
 	batch := new(leveldb.Batch)
 
-	iter := s.NewIterator(slice, nil)
+	iter := db.NewIterator(slice, nil)
 	defer iter.Release()
 	for iter.Next() {
 		if m.Match(iter.Key()) != inverted {
-			if dryRun {
+			if filter != nil {
+				if _, ok := filter.Apply(iter.Key(), iter.Value()); !ok {
+					continue
+				}
+			}
+			if dryRun && jw != nil {
+				if err := jw.WriteKey(iter.Key()); err != nil {
+					return err
+				}
+			} else if dryRun {
 				fmt.Print("Would delete ")
 				keywriter.Write(iter.Key())
 				fmt.Println()
@@ -336,7 +440,6 @@ func deleteCmd(c *cli.Context) error {
 	}
 
 	iter.Release()
-	s.Release()
 
 	if !dryRun {
 		if err := db.Write(batch, nil); err != nil {
@@ -344,7 +447,7 @@ func deleteCmd(c *cli.Context) error {
 		}
 	}
 
-	if err := db.Close(); err != nil {
+	if err := closeDB(); err != nil {
 		return err
 	}
 
@@ -357,34 +460,46 @@ func keysCmd(c *cli.Context) error {
 		w = newBase64Writer(os.Stdout)
 	} else if c.Bool("raw") {
 		w = os.Stdout
+	} else if c.Bool("indexeddb") {
+		w = newIndexedDBKeyWriter(os.Stdout, newPrettyPrinter(os.Stdout))
 	} else {
 		w = newPrettyPrinter(os.Stdout)
 	}
 
-	slice, err := getKeyRange(c)
+	jw, err := newJSONLWriter(c, os.Stdout)
+	if err != nil {
+		return err
+	}
+	filter, err := newValueFilter(c)
 	if err != nil {
 		return err
 	}
 
-	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
-		Comparer:       getComparer(c),
-		ErrorIfMissing: true,
-		ReadOnly:       true,
-	})
+	slice, err := getKeyRange(c)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	s, err := db.GetSnapshot()
+	db, closeDB, err := openDB(c, true)
 	if err != nil {
 		return err
 	}
-	defer s.Release()
+	defer closeDB()
 
-	iter := s.NewIterator(slice, nil)
+	iter := db.NewIterator(slice, nil)
 	defer iter.Release()
 	for iter.Next() {
+		if filter != nil {
+			if _, ok := filter.Apply(iter.Key(), iter.Value()); !ok {
+				continue
+			}
+		}
+		if jw != nil {
+			if err := jw.WriteKey(iter.Key()); err != nil {
+				return err
+			}
+			continue
+		}
 		if _, err := w.Write(iter.Key()); err != nil {
 			return err
 		}
@@ -397,61 +512,153 @@ func keysCmd(c *cli.Context) error {
 	}
 
 	iter.Release()
-	s.Release()
-	if err := db.Close(); err != nil {
+	if err := closeDB(); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func showCmd(c *cli.Context) error {
-	var kw, vw io.Writer
+func decodeIndexedDBValue(key, value []byte) (any, error) {
+	k, err := indexeddb.ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if k.Type() != indexeddb.ObjectStoreDataKey {
+		return nil, fmt.Errorf("not an object store record")
+	}
+	return indexeddb.DecodeValue(value)
+}
+
+type recordWriter struct {
+	kw  io.Writer
+	vw  io.Writer
+	jw  *prettyPrinter
+	sep string
+}
+
+func newRecordWriter(c *cli.Context) (*recordWriter, error) {
+	pd, err := newProtoDecoder(c)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := newCodecChain(c)
+	if err != nil {
+		return nil, err
+	}
+
+	rw := &recordWriter{sep: ": "}
 	if c.Bool("base64") {
-		kw = newBase64Writer(os.Stdout)
-		vw = newBase64Writer(os.Stdout)
+		rw.kw = newBase64Writer(os.Stdout)
+		rw.vw = newBase64Writer(os.Stdout)
 	} else if c.Bool("raw") {
-		kw = os.Stdout
-		vw = os.Stdout
+		rw.kw = os.Stdout
+		rw.vw = os.Stdout
 	} else {
-		kw = newPrettyPrinter(color.Output).SetQuoting(true)
-		vw = newPrettyPrinter(color.Output).
+		rw.kw = newPrettyPrinter(color.Output).SetQuoting(true)
+		if c.Bool("indexeddb") {
+			rw.kw = newIndexedDBKeyWriter(color.Output, rw.kw)
+		}
+		if c.Bool("hexdump") {
+			rw.vw = newHexdumpWriter(color.Output).SetTruncate(!c.Bool("no-truncate"))
+			rw.sep = ":\n"
+			return rw, nil
+		}
+		rw.vw = newPrettyPrinter(color.Output).
 			SetQuoting(true).
 			SetTruncate(!c.Bool("no-truncate")).
-			SetParseJSON(!c.Bool("no-json"))
+			SetParseJSON(!c.Bool("no-json")).
+			SetProtobuf(pd).
+			SetCodec(codec)
+		if c.Bool("indexeddb") && !c.Bool("no-json") {
+			rw.jw = newPrettyPrinter(color.Output)
+		}
 	}
+	return rw, nil
+}
 
-	slice, err := getKeyRange(c)
+func (rw *recordWriter) WriteKey(key []byte) error {
+	_, err := rw.kw.Write(key)
+	return err
+}
+
+// Separator returns the string written between a key and its value.
+func (rw *recordWriter) Separator() string {
+	return rw.sep
+}
+
+func (rw *recordWriter) WriteValue(key, value []byte) error {
+	if rw.jw != nil {
+		if obj, err := decodeIndexedDBValue(key, value); err == nil {
+			_, err := rw.jw.WriteJSON(obj)
+			return err
+		}
+	}
+	_, err := rw.vw.Write(value)
+	return err
+}
+
+func showCmd(c *cli.Context) error {
+	rw, err := newRecordWriter(c)
+	if err != nil {
+		return err
+	}
+	jw, err := newJSONLWriter(c, os.Stdout)
+	if err != nil {
+		return err
+	}
+	tw, err := newTemplateWriter(c, os.Stdout)
+	if err != nil {
+		return err
+	}
+	if jw != nil && tw != nil {
+		return fmt.Errorf("option --template cannot be used with --format=%s", c.String("format"))
+	}
+	filter, err := newValueFilter(c)
 	if err != nil {
 		return err
 	}
 
-	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
-		Comparer:       getComparer(c),
-		ErrorIfMissing: true,
-		ReadOnly:       true,
-	})
+	slice, err := getKeyRange(c)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
 
-	s, err := db.GetSnapshot()
+	db, closeDB, err := openDB(c, true)
 	if err != nil {
 		return err
 	}
-	defer s.Release()
+	defer closeDB()
 
-	iter := s.NewIterator(slice, nil)
+	iter := db.NewIterator(slice, nil)
 	defer iter.Release()
 	for iter.Next() {
-		if _, err := kw.Write(iter.Key()); err != nil {
+		value := iter.Value()
+		if filter != nil {
+			var ok bool
+			if value, ok = filter.Apply(iter.Key(), value); !ok {
+				continue
+			}
+		}
+		if tw != nil {
+			if err := tw.WriteEntry(iter.Key(), value); err != nil {
+				return err
+			}
+			continue
+		}
+		if jw != nil {
+			if err := jw.WriteEntry(iter.Key(), value); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := rw.WriteKey(iter.Key()); err != nil {
 			return err
 		}
-		if _, err := os.Stdout.WriteString(": "); err != nil {
+		if _, err := os.Stdout.WriteString(rw.Separator()); err != nil {
 			return err
 		}
-		if _, err := vw.Write(iter.Value()); err != nil {
+		if err := rw.WriteValue(iter.Key(), value); err != nil {
 			return err
 		}
 		if _, err := os.Stdout.WriteString("\n"); err != nil {
@@ -463,15 +670,14 @@ func showCmd(c *cli.Context) error {
 	}
 
 	iter.Release()
-	s.Release()
-	if err := db.Close(); err != nil {
+	if err := closeDB(); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func dumpDB(dbpath string, cmp comparer.Comparer, w io.Writer, pretty bool) error {
+func dumpDB(dbpath string, cmp comparer.Comparer, w io.Writer, pretty, hexdump bool) error {
 	db, err := leveldb.OpenFile(dbpath, &opt.Options{
 		Comparer:       cmp,
 		ErrorIfMissing: true,
@@ -488,79 +694,107 @@ func dumpDB(dbpath string, cmp comparer.Comparer, w io.Writer, pretty bool) erro
 	}
 	defer s.Release()
 
-	var entries []entry
+	bw := bufio.NewWriter(w)
+	enc := msgpack.NewEncoder(bw)
+	enc.UseCompactInts(true)
+	if !pretty {
+		// The map header needs the number of entries, so count them in a
+		// first pass over the snapshot instead of buffering the whole
+		// database.
+		nentries := 0
+		iter := s.NewIterator(nil, nil)
+		for iter.Next() {
+			nentries++
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+		if err := enc.EncodeMapLen(nentries); err != nil {
+			return err
+		}
+	}
 
+	re := regexp.MustCompile(`[\x00-\x1f\x7e-\xfd]`)
 	iter := s.NewIterator(nil, nil)
 	defer iter.Release()
 	for iter.Next() {
-		entries = append(entries, entry{
-			Key:   bytes.Clone(iter.Key()),
-			Value: bytes.Clone(iter.Value()),
-		})
-	}
-	if err := iter.Error(); err != nil {
-		return err
-	}
-
-	iter.Release()
-	s.Release()
-	if err := db.Close(); err != nil {
-		return err
-	}
-
-	enc := msgpack.NewEncoder(w)
-	enc.UseCompactInts(true)
-	if err := enc.EncodeMapLen(len(entries)); err != nil {
-		return err
-	}
-	for _, entry := range entries {
-		if pretty {
-			re, _ := regexp.Compile(`[\x00-\x1f\x7e-\xfd]`)
-			if len(entry.Key) > 7 && len(entry.Value) > 2 {
-				key := bytes.ReplaceAll(entry.Key, []byte{0x40, 0xff, 0xff}, []byte{})
+		key, value := iter.Key(), iter.Value()
+		if pretty && hexdump {
+			if _, err := fmt.Fprintf(bw, "%s:\n", escape(key)); err != nil {
+				return err
+			}
+			if _, err := newHexdumpWriter(bw).SetColor(false).Write(value); err != nil {
+				return err
+			}
+			if err := bw.WriteByte('\n'); err != nil {
+				return err
+			}
+		} else if pretty {
+			if len(key) > 7 && len(value) > 2 {
+				key = bytes.ReplaceAll(key, []byte{0x40, 0xff, 0xff}, []byte{})
 				key = bytes.ReplaceAll(key, []byte{0xff, 0x14, 0xff}, []byte{})
 
-				if _, err := w.Write(re.ReplaceAll(key, []byte(""))); err != nil {
+				if _, err := bw.Write(re.ReplaceAll(key, []byte(""))); err != nil {
 					return err
 				}
-				//if err := enc.EncodeBytes(re.ReplaceAll(key, []byte(""))); err != nil {
-				//	return err
-				//}
 			}
-			if len(entry.Value) > 14 {
-				value := bytes.ReplaceAll(entry.Value, []byte{0x40, 0xff, 0xff}, []byte{})
+			if len(value) > 14 {
+				value = bytes.ReplaceAll(value, []byte{0x40, 0xff, 0xff}, []byte{})
 				value = bytes.ReplaceAll(value, []byte{0x77, 0x42, 0x7b}, []byte{})
 
-				if _, err := w.Write(re.ReplaceAll(value, []byte(""))); err != nil {
+				if _, err := bw.Write(re.ReplaceAll(value, []byte(""))); err != nil {
+					return err
+				}
+				if err := bw.WriteByte(0x0a); err != nil {
 					return err
 				}
-				//if err := enc.EncodeBytes(re.ReplaceAll(value, []byte(""))); err != nil {
-				//	return err
-				//}
-				_, _ = w.Write([]byte{0x0a})
 			}
 		} else {
-			if err := enc.EncodeBytes(entry.Key); err != nil {
+			if err := enc.EncodeBytes(key); err != nil {
 				return err
 			}
-			if err := enc.EncodeBytes(entry.Value); err != nil {
+			if err := enc.EncodeBytes(value); err != nil {
 				return err
 			}
 		}
 	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	iter.Release()
+	s.Release()
+	if err := db.Close(); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// loadBatchSize is the approximate size of a batch committed by loadDB.
+const loadBatchSize = 4 * opt.MiB
+
 func loadDB(dbpath string, cmp comparer.Comparer, r io.Reader) error {
-	dec := msgpack.NewDecoder(r)
+	dec := msgpack.NewDecoder(bufio.NewReader(r))
 
 	nentries, err := dec.DecodeMapLen()
 	if err != nil {
 		return err
 	}
 
-	entries := make([]entry, nentries)
+	db, err := leveldb.OpenFile(dbpath, &opt.Options{
+		Comparer: cmp,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	batch := new(leveldb.Batch)
 	for i := 0; i < nentries; i++ {
 		key, err := dec.DecodeBytes()
 		if err != nil {
@@ -570,24 +804,19 @@ func loadDB(dbpath string, cmp comparer.Comparer, r io.Reader) error {
 		if err != nil {
 			return err
 		}
-		entries[i].Key = key
-		entries[i].Value = value
-	}
+		batch.Put(key, value)
 
-	db, err := leveldb.OpenFile(dbpath, &opt.Options{
-		Comparer: cmp,
-	})
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-
-	batch := new(leveldb.Batch)
-	for _, entry := range entries {
-		batch.Put(entry.Key, entry.Value)
+		if len(batch.Dump()) >= loadBatchSize {
+			if err := db.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
 	}
-	if err := db.Write(batch, nil); err != nil {
-		return err
+	if batch.Len() > 0 {
+		if err := db.Write(batch, nil); err != nil {
+			return err
+		}
 	}
 
 	if err := db.Close(); err != nil {
@@ -597,14 +826,27 @@ func loadDB(dbpath string, cmp comparer.Comparer, r io.Reader) error {
 	return nil
 }
 
-func destroyDB(dbpath string, dryRun bool) error {
-	dir, err := os.Open(dbpath)
+func readDirNames(dirpath string) ([]string, error) {
+	dir, err := os.Open(dirpath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer dir.Close()
 
 	names, err := dir.Readdirnames(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := dir.Close(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+func destroyDB(dbpath string, dryRun bool) error {
+	names, err := readDirNames(dbpath)
 	if err != nil {
 		return err
 	}
@@ -623,14 +865,14 @@ func destroyDB(dbpath string, dryRun bool) error {
 		}
 	}
 
-	if err := dir.Close(); err != nil {
-		return err
-	}
-
 	return nil
 }
 
 func dumpCmd(c *cli.Context) error {
+	if c.Bool("hexdump") && !c.Bool("pretty") {
+		return fmt.Errorf("option --hexdump requires --pretty")
+	}
+
 	var w io.Writer = os.Stdout
 	if c.NArg() >= 1 && c.Args().Get(0) != "-" {
 		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
@@ -645,7 +887,11 @@ func dumpCmd(c *cli.Context) error {
 		w = fh
 	}
 
-	return dumpDB(c.String("dbpath"), getComparer(c), w, c.Bool("pretty"))
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+	return dumpDB(c.String("dbpath"), cmp, w, c.Bool("pretty"), c.Bool("hexdump"))
 }
 
 func loadCmd(c *cli.Context) error {
@@ -659,11 +905,20 @@ func loadCmd(c *cli.Context) error {
 		r = fh
 	}
 
-	return loadDB(c.String("dbpath"), getComparer(c), r)
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+	return loadDB(c.String("dbpath"), cmp, r)
 }
 
 func repairCmd(c *cli.Context) (err error) {
-	db, err := leveldb.RecoverFile(c.String("dbpath"), nil)
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := leveldb.RecoverFile(c.String("dbpath"), &opt.Options{Comparer: cmp})
 	if err != nil {
 		return err
 	}
@@ -673,38 +928,199 @@ func repairCmd(c *cli.Context) (err error) {
 	return nil
 }
 
-func compactCmd(c *cli.Context) error {
-	dbpath := c.String("dbpath")
-	cmp := getComparer(c)
-	bakfile := path.Join(dbpath, "leveldb.bak")
+func copyDB(src, dst string, cmp comparer.Comparer) error {
+	sdb, err := leveldb.OpenFile(src, &opt.Options{
+		Comparer:       cmp,
+		ErrorIfMissing: true,
+		ReadOnly:       true,
+	})
+	if err != nil {
+		return err
+	}
+	defer sdb.Close()
+
+	ddb, err := leveldb.OpenFile(dst, &opt.Options{
+		Comparer:     cmp,
+		ErrorIfExist: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer ddb.Close()
 
-	bak, err := os.OpenFile(bakfile, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o600)
+	s, err := sdb.GetSnapshot()
 	if err != nil {
 		return err
 	}
-	defer bak.Close()
+	defer s.Release()
+
+	batch := new(leveldb.Batch)
+	iter := s.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		batch.Put(iter.Key(), iter.Value())
+		if len(batch.Dump()) >= loadBatchSize {
+			if err := ddb.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if err := ddb.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return err
+	}
 
-	if err := dumpDB(dbpath, cmp, bak, false); err != nil {
-		bak.Close()
-		os.Remove(bakfile)
+	iter.Release()
+	s.Release()
+	if err := ddb.Close(); err != nil {
 		return err
 	}
-	if _, err := bak.Seek(0, io.SeekStart); err != nil {
+	if err := sdb.Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// syncDir flushes the directory entries of dir to stable storage.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		// Directories cannot be opened for syncing on Windows.
+		return nil
+	}
+	f, err := os.Open(dir)
+	if err != nil {
 		return err
 	}
-	if err := bak.Sync(); err != nil {
+	defer f.Close()
+	if err := f.Sync(); err != nil {
 		return err
 	}
-	if err := destroyDB(dbpath, false); err != nil {
+	return f.Close()
+}
+
+// isCurrentDir reports whether dir is the current working directory.
+func isCurrentDir(dir string) (bool, error) {
+	wd, err := os.Stat(".")
+	if err != nil {
+		return false, err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(wd, fi), nil
+}
+
+func rebuildDB(dbpath string, cmp comparer.Comparer) error {
+	dbpath, err := filepath.Abs(dbpath)
+	if err != nil {
 		return err
 	}
-	if err := loadDB(dbpath, cmp, bak); err != nil {
+	parent := filepath.Dir(dbpath)
+	if parent == dbpath {
+		return fmt.Errorf("%s: cannot rebuild a database in the root directory", dbpath)
+	}
+
+	names, err := readDirNames(dbpath)
+	if err != nil {
 		return err
 	}
-	if err := bak.Close(); err != nil {
+	for _, filename := range names {
+		if !leveldbFilenamePattern.MatchString(filename) {
+			return fmt.Errorf("%s: not a LevelDB file; refusing to rebuild", filepath.Join(dbpath, filename))
+		}
+	}
+
+	// The temporary directory is created next to dbpath so that both renames
+	// stay within one file system.
+	tmpdir, err := os.MkdirTemp(parent, "."+filepath.Base(dbpath)+".rebuild-")
+	if err != nil {
 		return err
 	}
-	if err := os.Remove(bakfile); err != nil {
+	newpath := filepath.Join(tmpdir, "db")
+	if err := copyDB(dbpath, newpath, cmp); err != nil {
+		os.RemoveAll(tmpdir)
+		return err
+	}
+
+	// The current directory cannot be renamed on Windows, so step out of
+	// dbpath while swapping, as with the default --dbpath of ".".
+	if inDBPath, err := isCurrentDir(dbpath); err != nil {
+		os.RemoveAll(tmpdir)
+		return err
+	} else if inDBPath {
+		if err := os.Chdir(parent); err != nil {
+			os.RemoveAll(tmpdir)
+			return err
+		}
+		defer os.Chdir(dbpath)
+	}
+
+	// Swap the directories. A directory cannot atomically replace another
+	// one, so dbpath briefly does not exist between the two renames. If the
+	// process dies there, the complete original database remains in oldpath
+	// and the rebuilt one in newpath.
+	oldpath := filepath.Join(tmpdir, "old")
+	if err := os.Rename(dbpath, oldpath); err != nil {
+		os.RemoveAll(tmpdir)
+		return err
+	}
+	if err := os.Rename(newpath, dbpath); err != nil {
+		return fmt.Errorf("%w (the original database is left in %s)", err, oldpath)
+	}
+	if err := syncDir(parent); err != nil {
+		return fmt.Errorf("%w (the original database is left in %s)", err, oldpath)
+	}
+	if err := os.RemoveAll(tmpdir); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func compactCmd(c *cli.Context) error {
+	if c.Bool("rebuild") {
+		if hasKeyRange(c) {
+			return fmt.Errorf("option --rebuild cannot be used with a key range")
+		}
+		cmp, err := getComparer(c)
+		if err != nil {
+			return err
+		}
+		return rebuildDB(c.String("dbpath"), cmp)
+	}
+
+	slice, err := getKeyRange(c)
+	if err != nil {
+		return err
+	}
+	if slice == nil {
+		slice = &util.Range{}
+	}
+
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
+		Comparer:       cmp,
+		ErrorIfMissing: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.CompactRange(*slice); err != nil {
+		return err
+	}
+
+	if err := db.Close(); err != nil {
 		return err
 	}
 
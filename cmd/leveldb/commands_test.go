@@ -4,7 +4,14 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
 )
 
 func TestLevelDBFilenamePattern(t *testing.T) {
@@ -55,3 +62,126 @@ func TestLevelDBFilenamePattern(t *testing.T) {
 		}
 	}
 }
+
+func TestDumpLoad(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	db, err := leveldb.OpenFile(src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := new(leveldb.Batch)
+	for i := range 1000 {
+		batch.Put([]byte(fmt.Sprintf("key%04d", i)), bytes.Repeat([]byte{byte(i)}, 8192))
+	}
+	if err := db.Write(batch, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := dumpDB(src, comparer.DefaultComparer, buf, false, false); err != nil {
+		t.Fatalf("dumpDB: unexpected error: %v", err)
+	}
+	if err := loadDB(dst, comparer.DefaultComparer, buf); err != nil {
+		t.Fatalf("loadDB: unexpected error: %v", err)
+	}
+
+	db, err = leveldb.OpenFile(dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	n := 0
+	iter := db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		wantKey := []byte(fmt.Sprintf("key%04d", n))
+		wantValue := bytes.Repeat([]byte{byte(n)}, 8192)
+		if !bytes.Equal(iter.Key(), wantKey) || !bytes.Equal(iter.Value(), wantValue) {
+			t.Errorf("entry %d: got key %q, want %q", n, iter.Key(), wantKey)
+		}
+		n++
+	}
+	if err := iter.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1000 {
+		t.Errorf("loaded %d entries, want 1000", n)
+	}
+}
+
+func TestDumpHexdump(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "db")
+	db, err := leveldb.OpenFile(dbpath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if err := db.Put([]byte(key), []byte("v"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := dumpDB(dbpath, comparer.DefaultComparer, buf, true, true); err != nil {
+		t.Fatalf("dumpDB: unexpected error: %v", err)
+	}
+	if got := buf.String(); !strings.HasPrefix(got, "a:\n00000000: 76") || !strings.Contains(got, "\nb:\n") {
+		t.Errorf("dumpDB(pretty, hexdump) = %q", got)
+	}
+}
+
+func TestRebuildDB(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "db")
+
+	db, err := leveldb.OpenFile(dbpath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 100 {
+		if err := db.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("old"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put([]byte(fmt.Sprintf("key%02d", i)), []byte("new"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rebuildDB(dbpath, comparer.DefaultComparer); err != nil {
+		t.Fatalf("rebuildDB: unexpected error: %v", err)
+	}
+
+	names, err := readDirNames(filepath.Dir(dbpath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Errorf("rebuildDB left temporary files: %v", names)
+	}
+
+	db, err = leveldb.OpenFile(dbpath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := range 100 {
+		value, err := db.Get([]byte(fmt.Sprintf("key%02d", i)), nil)
+		if err != nil {
+			t.Errorf("key%02d: unexpected error: %v", i, err)
+		} else if string(value) != "new" {
+			t.Errorf("key%02d = %q, want %q", i, value, "new")
+		}
+	}
+}
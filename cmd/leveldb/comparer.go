@@ -0,0 +1,110 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/cions/leveldb-cli/dbfile"
+	"github.com/cions/leveldb-cli/indexeddb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/journal"
+	"github.com/urfave/cli/v2"
+)
+
+var comparers = make(map[string]comparer.Comparer)
+
+func init() {
+	registerComparer(comparer.DefaultComparer)
+	registerComparer(indexeddb.Comparer)
+}
+
+// registerComparer makes cmp available for databases whose MANIFEST records
+// cmp.Name() as the comparator.
+func registerComparer(cmp comparer.Comparer) {
+	comparers[cmp.Name()] = cmp
+}
+
+func lookupComparer(name string) (comparer.Comparer, error) {
+	if cmp, ok := comparers[name]; ok {
+		return cmp, nil
+	}
+	known := make([]string, 0, len(comparers))
+	for name := range comparers {
+		known = append(known, name)
+	}
+	slices.Sort(known)
+	return nil, fmt.Errorf("unknown comparator %q (supported: %s)", name, strings.Join(known, ", "))
+}
+
+// readComparerName returns the comparator name recorded in the MANIFEST file,
+// or an empty string if none is recorded.
+func readComparerName(manifest string) (string, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	r := journal.NewReader(f, nil, false, true)
+	for {
+		jr, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return "", nil
+		} else if err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(jr)
+		if err != nil {
+			continue
+		}
+		edit, err := dbfile.DecodeVersionEdit(data)
+		if err != nil {
+			continue
+		}
+		if edit.Comparer != nil {
+			return *edit.Comparer, nil
+		}
+	}
+}
+
+// detectComparer returns the name of the comparator used by the database, or
+// an empty string if the database does not exist.
+func detectComparer(dbpath string) (string, error) {
+	manifest, err := currentManifest(dbpath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return readComparerName(manifest)
+}
+
+func getComparer(c *cli.Context) (comparer.Comparer, error) {
+	if c.Bool("indexeddb") {
+		return indexeddb.Comparer, nil
+	}
+	if c.IsSet("indexeddb") {
+		return comparer.DefaultComparer, nil
+	}
+
+	name, err := detectComparer(c.String("dbpath"))
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return comparer.DefaultComparer, nil
+	}
+	cmp, err := lookupComparer(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", c.String("dbpath"), err)
+	}
+	return cmp, nil
+}
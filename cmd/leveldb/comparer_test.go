@@ -0,0 +1,67 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cions/leveldb-cli/indexeddb"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+type namedComparer struct {
+	comparer.Comparer
+	name string
+}
+
+func (c namedComparer) Name() string {
+	return c.name
+}
+
+func TestDetectComparer(t *testing.T) {
+	cases := []struct {
+		cmp     comparer.Comparer
+		wantErr bool
+	}{
+		{comparer.DefaultComparer, false},
+		{indexeddb.Comparer, false},
+		{namedComparer{comparer.DefaultComparer, "test.Unknown"}, true},
+	}
+
+	for _, tc := range cases {
+		dbpath := filepath.Join(t.TempDir(), "db")
+		db, err := leveldb.OpenFile(dbpath, &opt.Options{Comparer: tc.cmp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		name, err := detectComparer(dbpath)
+		if err != nil {
+			t.Fatalf("detectComparer: unexpected error: %v", err)
+		}
+		if name != tc.cmp.Name() {
+			t.Errorf("detectComparer() = %q, want %q", name, tc.cmp.Name())
+		}
+
+		cmp, err := lookupComparer(name)
+		if tc.wantErr {
+			if err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("lookupComparer(%q): got error %v, want error naming the comparator", name, err)
+			}
+		} else if err != nil || cmp.Name() != name {
+			t.Errorf("lookupComparer(%q) = %v, %v", name, cmp, err)
+		}
+	}
+
+	if name, err := detectComparer(filepath.Join(t.TempDir(), "missing")); err != nil || name != "" {
+		t.Errorf("detectComparer(missing) = %q, %v, want empty", name, err)
+	}
+}
@@ -6,6 +6,7 @@ package main
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/cions/leveldb-cli/indexeddb"
 	"github.com/fatih/color"
 )
 
@@ -41,11 +43,31 @@ func (w *base64Writer) Write(b []byte) (int, error) {
 	return base64.StdEncoding.EncodedLen(len(b)), nil
 }
 
+type indexedDBKeyWriter struct {
+	w        io.Writer
+	fallback io.Writer
+}
+
+func newIndexedDBKeyWriter(w, fallback io.Writer) *indexedDBKeyWriter {
+	return &indexedDBKeyWriter{w, fallback}
+}
+
+func (w *indexedDBKeyWriter) Write(b []byte) (int, error) {
+	key, err := indexeddb.ParseKey(b)
+	if err != nil {
+		return w.fallback.Write(b)
+	}
+	return io.WriteString(w.w, key.String())
+}
+
 type prettyPrinter struct {
 	w         io.Writer
 	quoting   bool
 	truncate  bool
 	parseJSON bool
+	nocolor   bool
+	protobuf  *protoDecoder
+	codec     codecChain
 }
 
 func newPrettyPrinter(w io.Writer) *prettyPrinter {
@@ -67,30 +89,84 @@ func (w *prettyPrinter) SetParseJSON(b bool) *prettyPrinter {
 	return w
 }
 
+func (w *prettyPrinter) SetProtobuf(d *protoDecoder) *prettyPrinter {
+	w.protobuf = d
+	return w
+}
+
+func (w *prettyPrinter) SetCodec(chain codecChain) *prettyPrinter {
+	w.codec = chain
+	return w
+}
+
+func (w *prettyPrinter) SetColor(b bool) *prettyPrinter {
+	w.nocolor = !b
+	return w
+}
+
+func (w *prettyPrinter) WriteJSON(obj interface{}) (int, error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(obj); err != nil {
+		return 0, err
+	}
+	buf.Truncate(buf.Len() - 1)
+	n, err := buf.WriteTo(w.w)
+	return int(n), err
+}
+
+// parseJSONValue parses b as JSON, unwrapping JSON-encoded strings first.
+// It returns the unwrapped bytes, the parsed value and whether b is JSON.
+func parseJSONValue(b []byte) ([]byte, interface{}, bool) {
+	for {
+		var s *string
+		if err := json.Unmarshal(b, &s); err != nil || s == nil {
+			break
+		}
+		b = []byte(*s)
+	}
+
+	var obj interface{}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return b, nil, false
+	}
+	return b, obj, true
+}
+
 func (w *prettyPrinter) Write(b []byte) (int, error) {
 	dimmed := color.New(color.Faint).FprintfFunc()
+	if w.nocolor {
+		dimmed = func(w io.Writer, format string, a ...interface{}) {
+			fmt.Fprintf(w, format, a...)
+		}
+	}
 
-	if w.parseJSON {
-		for {
-			var s *string
-			if err := json.Unmarshal(b, &s); err != nil || s == nil {
-				break
+	if len(w.codec) > 0 {
+		if decoded, obj, err := w.codec.Decode(b); err == nil {
+			if obj != nil {
+				return w.WriteJSON(obj)
 			}
-			b = []byte(*s)
+			b = decoded
 		}
+	}
 
-		var obj interface{}
-		if err := json.Unmarshal(b, &obj); err == nil {
-			buf := new(bytes.Buffer)
-			enc := json.NewEncoder(buf)
-			enc.SetEscapeHTML(false)
-			enc.SetIndent("", "  ")
-			if err := enc.Encode(obj); err != nil {
-				return 0, err
+	if w.protobuf != nil {
+		if w.protobuf.md != nil {
+			if obj, err := w.protobuf.DecodeJSON(b); err == nil {
+				return w.WriteJSON(obj)
 			}
-			buf.Truncate(buf.Len() - 1)
-			n, err := buf.WriteTo(w.w)
-			return int(n), err
+		} else if s, err := w.protobuf.DecodeRaw(b); err == nil {
+			return io.WriteString(w.w, s)
+		}
+	}
+
+	if w.parseJSON {
+		var obj interface{}
+		var ok bool
+		if b, obj, ok = parseJSONValue(b); ok {
+			return w.WriteJSON(obj)
 		}
 	}
 
@@ -105,7 +181,7 @@ func (w *prettyPrinter) Write(b []byte) (int, error) {
 	for len(b) > 0 {
 		r, size := utf8.DecodeRune(b)
 		switch {
-		case r == utf8.RuneError:
+		case r == utf8.RuneError && size == 1:
 			dimmed(buf, "\\x%02x", b[0])
 			nwritten += 4
 		case r == 0:
@@ -164,6 +240,84 @@ func (w *prettyPrinter) Write(b []byte) (int, error) {
 	return int(n), err
 }
 
+// hexdumpTruncateBytes is the number of bytes shown by a truncating
+// hexdumpWriter.
+const hexdumpTruncateBytes = 256
+
+type hexdumpWriter struct {
+	w        io.Writer
+	truncate bool
+	nocolor  bool
+}
+
+func newHexdumpWriter(w io.Writer) *hexdumpWriter {
+	return &hexdumpWriter{w: w}
+}
+
+func (w *hexdumpWriter) SetTruncate(b bool) *hexdumpWriter {
+	w.truncate = b
+	return w
+}
+
+func (w *hexdumpWriter) SetColor(b bool) *hexdumpWriter {
+	w.nocolor = !b
+	return w
+}
+
+// Write writes b in the format of xxd(1): offset, 16 bytes in groups of two,
+// and the ASCII representation. The last line is not terminated by a newline.
+func (w *hexdumpWriter) Write(b []byte) (int, error) {
+	dimmed := color.New(color.Faint).FprintfFunc()
+	if w.nocolor {
+		dimmed = func(w io.Writer, format string, a ...interface{}) {
+			fmt.Fprintf(w, format, a...)
+		}
+	}
+
+	total := len(b)
+	if w.truncate && len(b) > hexdumpTruncateBytes {
+		b = b[:hexdumpTruncateBytes]
+	}
+
+	buf := new(bytes.Buffer)
+	for offset := 0; offset < len(b); offset += 16 {
+		line := b[offset:min(offset+16, len(b))]
+		if offset > 0 {
+			buf.WriteByte('\n')
+		}
+		dimmed(buf, "%08x:", offset)
+		for i := 0; i < 16; i++ {
+			if i%2 == 0 {
+				buf.WriteByte(' ')
+			}
+			if i < len(line) {
+				fmt.Fprintf(buf, "%02x", line[i])
+			} else {
+				buf.WriteString("  ")
+			}
+		}
+		buf.WriteString("  ")
+		for _, c := range line {
+			if 0x20 <= c && c < 0x7f {
+				buf.WriteByte(c)
+			} else {
+				dimmed(buf, ".")
+			}
+		}
+	}
+	if len(b) < total {
+		dimmed(buf, "\n... (%d bytes total)", total)
+	}
+	n, err := buf.WriteTo(w.w)
+	return int(n), err
+}
+
+func escape(b []byte) string {
+	buf := new(bytes.Buffer)
+	newPrettyPrinter(buf).SetColor(false).Write(b)
+	return buf.String()
+}
+
 func decodeBase64(b []byte) ([]byte, error) {
 	b = bytes.TrimRight(b, "=")
 	n, err := base64.RawStdEncoding.Decode(b, b)
@@ -173,6 +327,16 @@ func decodeBase64(b []byte) ([]byte, error) {
 	return b[:n], nil
 }
 
+// decodeHex decodes a hex string, ignoring whitespace between digits.
+func decodeHex(b []byte) ([]byte, error) {
+	b = bytes.Join(bytes.Fields(b), nil)
+	n, err := hex.Decode(b, b)
+	if err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
+
 func parseHex(b []byte, n int) (uint32, bool) {
 	if len(b) < n {
 		return 0, false
@@ -100,6 +100,67 @@ func TestDecodeBase64(t *testing.T) {
 	}
 }
 
+func TestDecodeHex(t *testing.T) {
+	cases := []struct {
+		input, want []byte
+	}{
+		{[]byte(""), []byte("")},
+		{[]byte("6"), nil},
+		{[]byte("6162"), []byte("ab")},
+		{[]byte("61 62\n63"), []byte("abc")},
+		{[]byte("6G"), nil},
+	}
+
+	for _, tc := range cases {
+		got, err := decodeHex(tc.input)
+		if tc.want == nil && err == nil {
+			t.Errorf("decodeHex(%q) should fail", tc.input)
+		} else if tc.want != nil && err != nil {
+			t.Errorf("decodeHex(%q): unexpected error: %v", tc.input, err)
+		} else if tc.want != nil && !bytes.Equal(got, tc.want) {
+			t.Errorf("decodeHex(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestHexdumpWriter(t *testing.T) {
+	cases := []struct {
+		input    []byte
+		truncate bool
+		want     string
+	}{
+		{[]byte(""), false, ""},
+		{[]byte("abc\x00"), false, "00000000: 6162 6300                                abc."},
+		{
+			[]byte("0123456789abcdef0"),
+			false,
+			"00000000: 3031 3233 3435 3637 3839 6162 6364 6566  0123456789abcdef\n" +
+				"00000010: 30                                       0",
+		},
+		{
+			bytes.Repeat([]byte("a"), hexdumpTruncateBytes+1),
+			true,
+			"... (257 bytes total)",
+		},
+	}
+
+	for _, tc := range cases {
+		buf := new(bytes.Buffer)
+		newHexdumpWriter(buf).SetTruncate(tc.truncate).SetColor(false).Write(tc.input)
+		got := buf.String()
+		if tc.truncate {
+			lines := bytes.Split(buf.Bytes(), []byte("\n"))
+			if len(lines) != hexdumpTruncateBytes/16+1 {
+				t.Errorf("hexdump(%q): got %d lines", tc.input, len(lines))
+			}
+			got = string(lines[len(lines)-1])
+		}
+		if got != tc.want {
+			t.Errorf("hexdump(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
 func TestUnescape(t *testing.T) {
 	cases := []struct {
 		input, want []byte
@@ -126,3 +187,27 @@ func TestUnescape(t *testing.T) {
 		}
 	}
 }
+
+func TestEscape(t *testing.T) {
+	cases := []struct {
+		input []byte
+		want  string
+	}{
+		{[]byte(""), ``},
+		{[]byte("abc"), `abc`},
+		{[]byte("a\x00\n\x80"), `a\0\n\x80`},
+		{[]byte("\uFFFD\xef\xbf"), "\uFFFD\\xef\\xbf"},
+	}
+
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = false
+	for _, tc := range cases {
+		got := escape(tc.input)
+		if got != tc.want {
+			t.Errorf("escape(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+		if b, err := unescape([]byte(got)); err != nil || !bytes.Equal(b, tc.input) {
+			t.Errorf("unescape(escape(%q)) = %q, %v", tc.input, b, err)
+		}
+	}
+}
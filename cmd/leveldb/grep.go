@@ -0,0 +1,308 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/cions/leveldb-cli/indexeddb"
+	"github.com/fatih/color"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/urfave/cli/v2"
+)
+
+// grepPattern is implemented by *regexp.Regexp and literalPattern.
+type grepPattern interface {
+	Match(b []byte) bool
+	FindAllIndex(b []byte, n int) [][]int
+}
+
+// literalPattern matches any of the substrings.
+type literalPattern [][]byte
+
+func (m literalPattern) Match(b []byte) bool {
+	for _, pattern := range m {
+		if bytes.Contains(b, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindAllIndex returns the leftmost-longest non-overlapping occurrences of
+// the substrings in b.
+func (m literalPattern) FindAllIndex(b []byte, n int) [][]int {
+	var spans [][]int
+	for pos := 0; pos < len(b) && (n < 0 || len(spans) < n); {
+		start, end := -1, -1
+		for _, pattern := range m {
+			if len(pattern) == 0 {
+				continue
+			}
+			i := bytes.Index(b[pos:], pattern)
+			if i < 0 {
+				continue
+			}
+			if i += pos; start < 0 || i < start || i == start && i+len(pattern) > end {
+				start, end = i, i+len(pattern)
+			}
+		}
+		if start < 0 {
+			break
+		}
+		spans = append(spans, []int{start, end})
+		pos = end
+	}
+	return spans
+}
+
+func newGrepPattern(c *cli.Context) (grepPattern, error) {
+	args := c.Args().Slice()
+	if c.Bool("fixed-strings") {
+		literals := make(literalPattern, len(args))
+		for i, arg := range args {
+			literal, err := unescape([]byte(arg))
+			if err != nil {
+				return nil, err
+			}
+			literals[i] = literal
+		}
+		if !c.Bool("ignore-case") {
+			return literals, nil
+		}
+		for i, literal := range literals {
+			args[i] = regexp.QuoteMeta(string(literal))
+		}
+	}
+
+	patterns := make([]string, len(args))
+	for i, arg := range args {
+		patterns[i] = "(?:" + arg + ")"
+	}
+	pattern := strings.Join(patterns, "|")
+	if c.Bool("ignore-case") {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// grepText is a key or value as it is matched and printed.
+type grepText struct {
+	b       []byte
+	escaped bool // b is raw bytes that are escaped on output
+	quoted  bool // b is surrounded by double quotes on output
+}
+
+// Write writes t with the spans of t.b highlighted.
+func (t grepText) Write(w io.Writer, spans [][]int) error {
+	highlight := color.New(color.FgRed, color.Bold)
+	buf := new(bytes.Buffer)
+	writeSegment := func(b []byte, highlighted bool) {
+		if t.escaped {
+			quoted := new(bytes.Buffer)
+			newPrettyPrinter(quoted).SetQuoting(true).SetColor(!highlighted).Write(b)
+			b = quoted.Bytes()[1 : quoted.Len()-1]
+		}
+		if highlighted {
+			highlight.Fprint(buf, string(b))
+		} else {
+			buf.Write(b)
+		}
+	}
+
+	if t.quoted {
+		buf.WriteByte('"')
+	}
+	pos := 0
+	for _, span := range spans {
+		writeSegment(t.b[pos:span[0]], false)
+		writeSegment(t.b[span[0]:span[1]], true)
+		pos = span[1]
+	}
+	writeSegment(t.b[pos:], false)
+	if t.quoted {
+		buf.WriteByte('"')
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+type grepper struct {
+	pattern    grepPattern
+	matchKey   bool
+	matchValue bool
+	decoded    bool
+	indexedDB  bool
+	protobuf   *protoDecoder
+	codec      codecChain
+}
+
+// keyText returns the key as printed by show if keys are not matched or
+// --decoded is given, or the raw key otherwise.
+func (g *grepper) keyText(key []byte) grepText {
+	if g.indexedDB && (g.decoded || !g.matchKey) {
+		if k, err := indexeddb.ParseKey(key); err == nil {
+			return grepText{b: []byte(k.String())}
+		}
+	}
+	return grepText{b: key, escaped: true, quoted: true}
+}
+
+// valueText returns the value as printed by show if values are not matched
+// or --decoded is given, or the raw value otherwise.
+func (g *grepper) valueText(key, value []byte) grepText {
+	if !g.decoded && g.matchValue {
+		return grepText{b: value, escaped: true, quoted: true}
+	}
+
+	buf := new(bytes.Buffer)
+	if g.indexedDB {
+		if obj, err := decodeIndexedDBValue(key, value); err == nil {
+			if _, err := newPrettyPrinter(buf).WriteJSON(obj); err == nil {
+				return grepText{b: buf.Bytes()}
+			}
+			buf.Reset()
+		}
+	}
+	newPrettyPrinter(buf).
+		SetQuoting(true).
+		SetParseJSON(true).
+		SetProtobuf(g.protobuf).
+		SetCodec(g.codec).
+		SetColor(false).
+		Write(value)
+	if b := buf.Bytes(); len(b) >= 2 && b[0] == '"' {
+		return grepText{b: b[1 : len(b)-1], quoted: true}
+	}
+	return grepText{b: buf.Bytes()}
+}
+
+func grepCmd(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return usageError(c)
+	}
+
+	pattern, err := newGrepPattern(c)
+	if err != nil {
+		return err
+	}
+	g := &grepper{
+		pattern:   pattern,
+		decoded:   c.Bool("decoded"),
+		indexedDB: c.Bool("indexeddb"),
+	}
+	switch target := c.String("search"); target {
+	case "value":
+		g.matchValue = true
+	case "key":
+		g.matchKey = true
+	case "both":
+		g.matchKey, g.matchValue = true, true
+	default:
+		return fmt.Errorf("option --search: unknown target %q", target)
+	}
+	if g.protobuf, err = newProtoDecoder(c); err != nil {
+		return err
+	}
+	if g.codec, err = newCodecChain(c); err != nil {
+		return err
+	}
+	inverted := c.Bool("invert-match")
+	countOnly := c.Bool("count")
+
+	slice, err := getKeyRange(c)
+	if err != nil {
+		return err
+	}
+
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
+		Comparer:       cmp,
+		ErrorIfMissing: true,
+		ReadOnly:       true,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	s, err := db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer s.Release()
+
+	count := 0
+	iter := s.NewIterator(slice, nil)
+	defer iter.Release()
+	for iter.Next() {
+		key := g.keyText(iter.Key())
+		// Decoding values is costly, so do it only when they are searched
+		// or printed.
+		var value grepText
+		if g.matchValue {
+			value = g.valueText(iter.Key(), iter.Value())
+		}
+
+		matched := g.matchKey && pattern.Match(key.b) || g.matchValue && pattern.Match(value.b)
+		if matched == inverted {
+			continue
+		}
+		count++
+		if countOnly {
+			continue
+		}
+		if !g.matchValue {
+			value = g.valueText(iter.Key(), iter.Value())
+		}
+
+		var keySpans, valueSpans [][]int
+		if !inverted && g.matchKey {
+			keySpans = pattern.FindAllIndex(key.b, -1)
+		}
+		if !inverted && g.matchValue {
+			valueSpans = pattern.FindAllIndex(value.b, -1)
+		}
+		if err := key.Write(color.Output, keySpans); err != nil {
+			return err
+		}
+		if _, err := os.Stdout.WriteString(": "); err != nil {
+			return err
+		}
+		if err := value.Write(color.Output, valueSpans); err != nil {
+			return err
+		}
+		if _, err := os.Stdout.WriteString("\n"); err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	iter.Release()
+	s.Release()
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	if countOnly {
+		if _, err := fmt.Println(count); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestLiteralPatternFindAllIndex(t *testing.T) {
+	cases := []struct {
+		patterns []string
+		input    string
+		want     string
+	}{
+		{[]string{"a"}, "banana", "[[1 2] [3 4] [5 6]]"},
+		{[]string{"an", "ana"}, "banana", "[[1 4]]"},
+		{[]string{"na", "b"}, "banana", "[[0 1] [2 4] [4 6]]"},
+		{[]string{"x"}, "banana", "[]"},
+		{[]string{""}, "banana", "[]"},
+	}
+
+	for _, tc := range cases {
+		var m literalPattern
+		for _, p := range tc.patterns {
+			m = append(m, []byte(p))
+		}
+		if got := fmt.Sprint(m.FindAllIndex([]byte(tc.input), -1)); got != tc.want {
+			t.Errorf("%q.FindAllIndex(%q) = %s, want %s", tc.patterns, tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestGrepTextWrite(t *testing.T) {
+	cases := []struct {
+		text  grepText
+		spans [][]int
+		want  string
+	}{
+		{grepText{b: []byte("abc"), escaped: true, quoted: true}, nil, `"abc"`},
+		{grepText{b: []byte("a\"\x00b"), escaped: true, quoted: true}, [][]int{{1, 3}}, "\"a\x1b[31;1m\\\"\\0\x1b[0mb\""},
+		{grepText{b: []byte("{\n  \"a\": 1\n}")}, [][]int{{4, 7}}, "{\n  \x1b[31;1m\"a\"\x1b[0m: 1\n}"},
+	}
+
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = false
+	for _, tc := range cases {
+		buf := new(bytes.Buffer)
+		if err := tc.text.Write(buf, tc.spans); err != nil {
+			t.Fatal(err)
+		}
+		got := bytes.ReplaceAll(buf.Bytes(), []byte("\x1b[2m"), nil)
+		got = bytes.ReplaceAll(got, []byte("\x1b[22m"), nil)
+		if string(got) != tc.want {
+			t.Errorf("Write(%q, %v) = %q, want %q", tc.text.b, tc.spans, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/cions/leveldb-cli/dbfile"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/urfave/cli/v2"
+)
+
+var dataFilenamePattern = regexp.MustCompile(`\A\d+\.(?:ldb|log|sst)\z`)
+
+type keyVersion struct {
+	File  string
+	Seq   uint64
+	Kind  dbfile.Kind
+	Key   []byte
+	Value []byte
+	Live  bool
+}
+
+func scanTable(path string, fn func(v *keyVersion)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	t, err := dbfile.OpenTable(f, fi.Size())
+	if err != nil {
+		// Keep going, as other tables may still hold versions of the keys.
+		fmt.Fprintf(os.Stderr, "leveldb: %s: %v\n", filepath.Base(path), err)
+		return nil
+	}
+	for i, entry := range t.Index {
+		block, err := t.ReadBlock(entry.Handle)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "leveldb: %s: block #%d: %v\n", filepath.Base(path), i, err)
+			continue
+		}
+		for _, e := range block.Entries {
+			ikey, err := dbfile.ParseInternalKey(e.Key)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "leveldb: %s: block #%d: %v\n", filepath.Base(path), i, err)
+				continue
+			}
+			fn(&keyVersion{
+				File:  filepath.Base(path),
+				Seq:   ikey.Seq,
+				Kind:  ikey.Kind,
+				Key:   ikey.UserKey,
+				Value: e.Value,
+			})
+		}
+	}
+
+	return f.Close()
+}
+
+func scanLog(path string, fn func(v *keyVersion)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = readJournal(f, os.Stderr, func(i int, data []byte) error {
+		batch, err := dbfile.DecodeBatch(data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "leveldb: %s: record #%d: %v\n", filepath.Base(path), i, err)
+		}
+		if batch == nil {
+			return nil
+		}
+		for _, record := range batch.Records {
+			fn(&keyVersion{
+				File:  filepath.Base(path),
+				Seq:   record.Seq,
+				Kind:  record.Kind,
+				Key:   record.Key,
+				Value: record.Value,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func inRange(cmp comparer.Comparer, slice *util.Range, key []byte) bool {
+	if slice == nil {
+		return true
+	}
+	if slice.Start != nil && cmp.Compare(key, slice.Start) < 0 {
+		return false
+	}
+	if slice.Limit != nil && cmp.Compare(key, slice.Limit) >= 0 {
+		return false
+	}
+	return true
+}
+
+// collectVersions reads every entry in the table and log files of the
+// database, sorted by key and then by sequence number in descending order.
+func collectVersions(dbpath string, cmp comparer.Comparer, slice *util.Range) ([]*keyVersion, error) {
+	names, err := readDirNames(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+
+	var versions []*keyVersion
+	collect := func(v *keyVersion) {
+		if inRange(cmp, slice, v.Key) {
+			versions = append(versions, v)
+		}
+	}
+	for _, name := range names {
+		if !dataFilenamePattern.MatchString(name) {
+			continue
+		}
+		scan := scanTable
+		if filepath.Ext(name) == ".log" {
+			scan = scanLog
+		}
+		if err := scan(filepath.Join(dbpath, name), collect); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	slices.SortStableFunc(versions, func(a, b *keyVersion) int {
+		if n := cmp.Compare(a.Key, b.Key); n != 0 {
+			return n
+		}
+		switch {
+		case a.Seq > b.Seq:
+			return -1
+		case a.Seq < b.Seq:
+			return 1
+		}
+		return 0
+	})
+
+	for i := 0; i < len(versions); {
+		j := i + 1
+		for j < len(versions) && cmp.Compare(versions[i].Key, versions[j].Key) == 0 {
+			j++
+		}
+		newest := versions[i]
+		for _, v := range versions[i:j] {
+			v.Live = newest.Kind == dbfile.KindPut && v.Kind == dbfile.KindPut && v.Seq == newest.Seq
+		}
+		i = j
+	}
+
+	return versions, nil
+}
+
+type historyRecord struct {
+	Key   string  `json:"key"`
+	Seq   uint64  `json:"seq"`
+	Kind  string  `json:"kind"`
+	Value *string `json:"value,omitempty"`
+	File  string  `json:"file"`
+	Live  bool    `json:"live"`
+}
+
+func historyCmd(c *cli.Context) error {
+	slice, err := getKeyRange(c)
+	if err != nil {
+		return err
+	}
+
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
+	versions, err := collectVersions(c.String("dbpath"), cmp, slice)
+	if err != nil {
+		return err
+	}
+	if c.Bool("hidden") {
+		versions = slices.DeleteFunc(versions, func(v *keyVersion) bool {
+			return v.Live
+		})
+	}
+
+	if c.Bool("json") {
+		encode := escape
+		if c.Bool("base64") {
+			encode = base64.StdEncoding.EncodeToString
+		} else if c.Bool("raw") {
+			encode = func(b []byte) string { return string(b) }
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		for _, v := range versions {
+			record := historyRecord{
+				Key:  encode(v.Key),
+				Seq:  v.Seq,
+				Kind: v.Kind.String(),
+				File: v.File,
+				Live: v.Live,
+			}
+			if v.Kind == dbfile.KindPut {
+				value := encode(v.Value)
+				record.Value = &value
+			}
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	rw, err := newRecordWriter(c)
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if err := rw.WriteKey(v.Key); err != nil {
+			return err
+		}
+		status := v.File
+		if v.Live {
+			status += ", live"
+		}
+		if _, err := fmt.Printf(" seq=%d %v (%s)", v.Seq, v.Kind, status); err != nil {
+			return err
+		}
+		if v.Kind == dbfile.KindPut {
+			if _, err := os.Stdout.WriteString(rw.Separator()); err != nil {
+				return err
+			}
+			if err := rw.WriteValue(v.Key, v.Value); err != nil {
+				return err
+			}
+		}
+		if _, err := os.Stdout.WriteString("\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
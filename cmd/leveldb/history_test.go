@@ -0,0 +1,62 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func TestCollectVersions(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "db")
+	db, err := leveldb.OpenFile(dbpath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range []struct{ key, value string }{
+		{"a", "1"}, {"b", "1"}, {"a", "2"}, {"b", ""}, {"c", "1"},
+	} {
+		if op.value == "" {
+			err = db.Delete([]byte(op.key), nil)
+		} else {
+			err = db.Put([]byte(op.key), []byte(op.value), nil)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A corrupt table is skipped with a warning.
+	if err := os.WriteFile(filepath.Join(dbpath, "999999.ldb"), []byte("corrupt"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := collectVersions(dbpath, comparer.DefaultComparer, &util.Range{Limit: []byte("c")})
+	if err != nil {
+		t.Fatalf("collectVersions: unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, v := range versions {
+		got = append(got, fmt.Sprintf("%s/%d/%v/%s/%t", v.Key, v.Seq, v.Kind, v.Value, v.Live))
+	}
+	want := []string{
+		"a/3/put/2/true",
+		"a/1/put/1/false",
+		"b/4/delete//false",
+		"b/2/put/1/false",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("collectVersions() = %v, want %v", got, want)
+	}
+}
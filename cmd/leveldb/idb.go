@@ -0,0 +1,182 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/cions/leveldb-cli/indexeddb"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/urfave/cli/v2"
+)
+
+func formatKeyPath(keyPath any) string {
+	b, err := json.Marshal(keyPath)
+	if err != nil {
+		return fmt.Sprint(keyPath)
+	}
+	return string(b)
+}
+
+func writeSchemaTree(w io.Writer, dbs []*indexeddb.Database) error {
+	for _, db := range dbs {
+		_, err := fmt.Fprintf(w, "%s (id=%d, origin=%s, version=%d)\n",
+			strconv.Quote(db.Name), db.Id, strconv.Quote(db.Origin), db.Version)
+		if err != nil {
+			return err
+		}
+
+		for i, store := range db.ObjectStores {
+			branch, indent := "├── ", "│   "
+			if i == len(db.ObjectStores)-1 {
+				branch, indent = "└── ", "    "
+			}
+			_, err := fmt.Fprintf(w, "%s%s (id=%d, keyPath=%s, autoIncrement=%t, keyGenerator=%d)\n",
+				branch, strconv.Quote(store.Name), store.Id, formatKeyPath(store.KeyPath), store.AutoIncrement, store.KeyGenerator)
+			if err != nil {
+				return err
+			}
+
+			for j, index := range store.Indexes {
+				branch := "├── "
+				if j == len(store.Indexes)-1 {
+					branch = "└── "
+				}
+				_, err := fmt.Fprintf(w, "%s%s%s (id=%d, keyPath=%s, unique=%t, multiEntry=%t)\n",
+					indent, branch, strconv.Quote(index.Name), index.Id, formatKeyPath(index.KeyPath), index.Unique, index.MultiEntry)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func idbSchemaCmd(c *cli.Context) error {
+	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
+		Comparer:       indexeddb.Comparer,
+		ErrorIfMissing: true,
+		ReadOnly:       true,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	s, err := db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer s.Release()
+
+	dbs, err := indexeddb.ReadSchema(s)
+	if err != nil {
+		return err
+	}
+
+	s.Release()
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		if _, err := newPrettyPrinter(os.Stdout).WriteJSON(dbs); err != nil {
+			return err
+		}
+		_, err := os.Stdout.WriteString("\n")
+		return err
+	}
+	return writeSchemaTree(os.Stdout, dbs)
+}
+
+func findObjectStore(dbs []*indexeddb.Database, origin, database, objectStore string) (*indexeddb.Database, *indexeddb.ObjectStore, error) {
+	var found *indexeddb.Database
+	for _, db := range dbs {
+		if db.Name != database || (origin != "" && db.Origin != origin) {
+			continue
+		}
+		if found != nil {
+			return nil, nil, fmt.Errorf("database %q exists in multiple origins; specify --origin", database)
+		}
+		found = db
+	}
+	if found == nil {
+		return nil, nil, fmt.Errorf("database %q not found", database)
+	}
+
+	store := found.ObjectStore(objectStore)
+	if store == nil {
+		return nil, nil, fmt.Errorf("object store %q not found in database %q", objectStore, database)
+	}
+	return found, store, nil
+}
+
+type exportRecord struct {
+	Key   any    `json:"key"`
+	Value any    `json:"value"`
+	Error string `json:"error,omitempty"`
+}
+
+func idbExportCmd(c *cli.Context) error {
+	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
+		Comparer:       indexeddb.Comparer,
+		ErrorIfMissing: true,
+		ReadOnly:       true,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	s, err := db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer s.Release()
+
+	dbs, err := indexeddb.ReadSchema(s)
+	if err != nil {
+		return err
+	}
+	database, store, err := findObjectStore(dbs, c.String("origin"), c.String("database"), c.String("object-store"))
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+
+	iter := s.NewIterator(indexeddb.ObjectStoreDataRange(database.Id, store.Id), nil)
+	defer iter.Release()
+	for iter.Next() {
+		key, err := indexeddb.ParseKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		record := exportRecord{Key: key.UserKey}
+		if record.Value, err = indexeddb.DecodeValue(iter.Value()); err != nil {
+			record.Error = err.Error()
+		}
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	iter.Release()
+	s.Release()
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/urfave/cli/v2"
+)
+
+var byteEncodings = map[string]func([]byte) string{
+	"utf8":   escape,
+	"base64": base64.StdEncoding.EncodeToString,
+	"hex":    hex.EncodeToString,
+}
+
+// jsonlKeyRecord is a key without its value, as written by keys.
+type jsonlKeyRecord struct {
+	Key string `json:"key"`
+}
+
+// jsonlRecord is an entry. Value is always present, so that null values are
+// distinguishable from key records.
+type jsonlRecord struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+type jsonlWriter struct {
+	enc       *json.Encoder
+	encode    func([]byte) string
+	parseJSON bool
+	indexedDB bool
+}
+
+// newJSONLWriter returns a jsonlWriter if --format=jsonl is given, or nil if
+// the output format is text.
+func newJSONLWriter(c *cli.Context, w io.Writer) (*jsonlWriter, error) {
+	switch format := c.String("format"); format {
+	case "", "text":
+		return nil, nil
+	case "jsonl":
+	default:
+		return nil, fmt.Errorf("option --format: unknown format %q", format)
+	}
+
+	encode, ok := byteEncodings[c.String("encoding")]
+	if !ok {
+		return nil, fmt.Errorf("option --encoding: unknown encoding %q", c.String("encoding"))
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &jsonlWriter{
+		enc:       enc,
+		encode:    encode,
+		parseJSON: !c.Bool("no-json"),
+		indexedDB: c.Bool("indexeddb"),
+	}, nil
+}
+
+func (w *jsonlWriter) value(key, value []byte) any {
+	if w.parseJSON {
+		if w.indexedDB {
+			if obj, err := decodeIndexedDBValue(key, value); err == nil {
+				return obj
+			}
+		}
+		if b, _, ok := parseJSONValue(value); ok {
+			buf := new(bytes.Buffer)
+			if err := json.Compact(buf, b); err == nil {
+				return json.RawMessage(buf.Bytes())
+			}
+		}
+	}
+	return w.encode(value)
+}
+
+func (w *jsonlWriter) WriteKey(key []byte) error {
+	return w.enc.Encode(jsonlKeyRecord{Key: w.encode(key)})
+}
+
+func (w *jsonlWriter) WriteEntry(key, value []byte) error {
+	return w.enc.Encode(jsonlRecord{Key: w.encode(key), Value: w.value(key, value)})
+}
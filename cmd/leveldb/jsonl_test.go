@@ -0,0 +1,61 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONLWriter(t *testing.T) {
+	cases := []struct {
+		encoding  string
+		parseJSON bool
+		key       string
+		value     string
+		want      string
+	}{
+		{"utf8", true, "k", `{"a": [1, 2]}`, `{"key":"k","value":{"a":[1,2]}}`},
+		{"utf8", true, "k", `"{\"a\":1}"`, `{"key":"k","value":{"a":1}}`},
+		{"utf8", false, "k", `{"a":1}`, `{"key":"k","value":"{\"a\":1}"}`},
+		{"utf8", true, "k\x00", "v\xff", `{"key":"k\\0","value":"v\\xff"}`},
+		{"utf8", true, "k", "", `{"key":"k","value":""}`},
+		{"base64", true, "k", "v", `{"key":"aw==","value":"dg=="}`},
+		{"hex", true, "k", "v", `{"key":"6b","value":"76"}`},
+	}
+
+	for _, tc := range cases {
+		buf := new(bytes.Buffer)
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		w := &jsonlWriter{enc: enc, encode: byteEncodings[tc.encoding], parseJSON: tc.parseJSON}
+		if err := w.WriteEntry([]byte(tc.key), []byte(tc.value)); err != nil {
+			t.Fatalf("WriteEntry: unexpected error: %v", err)
+		}
+		if got := buf.String(); got != tc.want+"\n" {
+			t.Errorf("WriteEntry(%q, %q) = %s, want %s", tc.key, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestJSONLRecord(t *testing.T) {
+	// A decoded IndexedDB value of null or undefined is a nil interface.
+	b, err := json.Marshal(jsonlRecord{Key: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"key":"k","value":null}`; got != want {
+		t.Errorf("jsonlRecord = %s, want %s", got, want)
+	}
+
+	buf := new(bytes.Buffer)
+	w := &jsonlWriter{enc: json.NewEncoder(buf), encode: byteEncodings["utf8"]}
+	if err := w.WriteKey([]byte("k")); err != nil {
+		t.Fatalf("WriteKey: unexpected error: %v", err)
+	}
+	if got, want := buf.String(), `{"key":"k"}`+"\n"; got != want {
+		t.Errorf("WriteKey() = %s, want %s", got, want)
+	}
+}
@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -12,6 +13,7 @@ import (
 	"runtime/debug"
 	"strings"
 
+	"github.com/cions/leveldb-cli/indexeddb"
 	"github.com/urfave/cli/v2"
 )
 
@@ -23,7 +25,9 @@ func getVersion() string {
 }
 
 func main() {
-	var lockFile string
+	var lockFile, snapshotDir string
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	app := &cli.App{
 		Name:    "leveldb",
@@ -40,15 +44,42 @@ func main() {
 			&cli.BoolFlag{
 				Name:    "indexeddb",
 				Aliases: []string{"i"},
-				Usage:   "open Chromium's IndexedDB database",
+				Usage:   "open Chromium's IndexedDB database (detected automatically by default)",
+			},
+			&cli.BoolFlag{
+				Name:    "copy",
+				Aliases: []string{"snapshot"},
+				Usage:   "open a temporary copy of the database (read-only commands only)",
 			},
 		},
 		UseShortOptionHandling: true,
 		Before: func(c *cli.Context) error {
+			if c.Bool("copy") {
+				if err := checkReadOnlyCommand(c); err != nil {
+					return err
+				}
+				dir, err := snapshotDB(c.String("dbpath"))
+				if err != nil {
+					return err
+				}
+				snapshotDir = dir
+				removeOnSignal(c, dir, cancel)
+				if err := c.Set("dbpath", dir); err != nil {
+					return err
+				}
+			}
 			p := path.Join(c.String("dbpath"), "LOCK")
 			if _, err := os.Stat(p); errors.Is(err, fs.ErrNotExist) {
 				lockFile = p
 			}
+			if !c.IsSet("indexeddb") {
+				name, err := detectComparer(c.String("dbpath"))
+				if err == nil && name == indexeddb.Comparer.Name() {
+					if err := c.Set("indexeddb", "true"); err != nil {
+						return err
+					}
+				}
+			}
 			return nil
 		},
 		DefaultCommand: "show",
@@ -76,6 +107,32 @@ func main() {
 						Aliases: []string{"b"},
 						Usage:   "interpret arguments as base64-encoded",
 					},
+					&cli.BoolFlag{
+						Name:    "hex",
+						Aliases: []string{"x"},
+						Usage:   "interpret arguments as hex-encoded",
+					},
+					&cli.BoolFlag{
+						Name:    "hexdump",
+						Aliases: []string{"X"},
+						Usage:   "show values as a hex dump",
+					},
+					&cli.BoolFlag{
+						Name:  "protobuf",
+						Usage: "decode values as protobuf without a schema",
+					},
+					&cli.StringFlag{
+						Name:  "proto-descriptor",
+						Usage: "decode values as protobuf using the FileDescriptorSet in `file`",
+					},
+					&cli.StringFlag{
+						Name:  "proto-type",
+						Usage: "fully-qualified `name` of the protobuf message type of values",
+					},
+					&cli.StringFlag{
+						Name:  "value-codec",
+						Usage: "decode values with the comma-separated `codecs` (msgpack, cbor, bson, gzip, zlib, snappy, auto)",
+					},
 				},
 				Action: getCmd,
 			},
@@ -95,6 +152,11 @@ func main() {
 						Aliases: []string{"b"},
 						Usage:   "interpret arguments as base64-encoded",
 					},
+					&cli.BoolFlag{
+						Name:    "hex",
+						Aliases: []string{"x"},
+						Usage:   "interpret arguments as hex-encoded",
+					},
 				},
 				Action: putCmd,
 			},
@@ -114,6 +176,11 @@ func main() {
 						Aliases: []string{"b"},
 						Usage:   "interpret arguments as base64-encoded",
 					},
+					&cli.BoolFlag{
+						Name:    "hex",
+						Aliases: []string{"x"},
+						Usage:   "interpret arguments as hex-encoded",
+					},
 					&cli.BoolFlag{
 						Name:    "regexp",
 						Aliases: []string{"R"},
@@ -124,6 +191,22 @@ func main() {
 						Aliases: []string{"v"},
 						Usage:   "invert the sense of matching; delete non-matching keys",
 					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   "text",
+						Usage:   "output `format` of --dry-run (text, jsonl)",
+					},
+					&cli.StringFlag{
+						Name:  "encoding",
+						Value: "utf8",
+						Usage: "`encoding` of keys and values in JSON Lines output (utf8, base64, hex)",
+					},
+					&cli.StringFlag{
+						Name:    "where",
+						Aliases: []string{"W"},
+						Usage:   "only include entries whose JSON values satisfy the jq-style `expression`",
+					},
 					&cli.StringFlag{
 						Name:    "start",
 						Aliases: []string{"s"},
@@ -138,6 +221,10 @@ func main() {
 						Name:  "start-base64",
 						Usage: "start of the `key` range (base64, inclusive)",
 					},
+					&cli.StringFlag{
+						Name:  "start-hex",
+						Usage: "start of the `key` range (hex, inclusive)",
+					},
 					&cli.StringFlag{
 						Name:    "end",
 						Aliases: []string{"e"},
@@ -152,6 +239,10 @@ func main() {
 						Name:  "end-base64",
 						Usage: "end of the `key` range (base64, exclusive)",
 					},
+					&cli.StringFlag{
+						Name:  "end-hex",
+						Usage: "end of the `key` range (hex, exclusive)",
+					},
 					&cli.StringFlag{
 						Name:    "prefix",
 						Aliases: []string{"p"},
@@ -166,6 +257,10 @@ func main() {
 						Name:  "prefix-base64",
 						Usage: "limit the key range to a range that satisfy the given `prefix` (base64)",
 					},
+					&cli.StringFlag{
+						Name:  "prefix-hex",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (hex)",
+					},
 					&cli.BoolFlag{
 						Name:    "dry-run",
 						Aliases: []string{"n"},
@@ -175,6 +270,49 @@ func main() {
 				UseShortOptionHandling: true,
 				Action:                 deleteCmd,
 			},
+			{
+				Name:      "batch",
+				Usage:     "apply puts and deletes from a script atomically",
+				ArgsUsage: "[input]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "raw",
+						Aliases: []string{"r"},
+						Usage:   "do not interpret backslash escapes in script arguments",
+					},
+					&cli.BoolFlag{
+						Name:    "base64",
+						Aliases: []string{"b"},
+						Usage:   "interpret script arguments as base64-encoded",
+					},
+					&cli.BoolFlag{
+						Name:    "hex",
+						Aliases: []string{"x"},
+						Usage:   "interpret script arguments as hex-encoded",
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   "script",
+						Usage:   "input `format` (script, jsonl)",
+					},
+					&cli.StringFlag{
+						Name:  "encoding",
+						Value: "utf8",
+						Usage: "`encoding` of keys and values in JSON Lines input (utf8, base64, hex)",
+					},
+					&cli.BoolFlag{
+						Name:    "dry-run",
+						Aliases: []string{"n"},
+						Usage:   "do not actually commit; just show what would be applied",
+					},
+					&cli.BoolFlag{
+						Name:  "validate",
+						Usage: "only parse the input without opening the database",
+					},
+				},
+				Action: batchCmd,
+			},
 			{
 				Name:      "keys",
 				Aliases:   []string{"k"},
@@ -191,6 +329,22 @@ func main() {
 						Aliases: []string{"b"},
 						Usage:   "show keys in base64 encoding",
 					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   "text",
+						Usage:   "output `format` (text, jsonl)",
+					},
+					&cli.StringFlag{
+						Name:  "encoding",
+						Value: "utf8",
+						Usage: "`encoding` of keys and values in JSON Lines output (utf8, base64, hex)",
+					},
+					&cli.StringFlag{
+						Name:    "where",
+						Aliases: []string{"W"},
+						Usage:   "only include entries whose JSON values satisfy the jq-style `expression`",
+					},
 					&cli.StringFlag{
 						Name:    "start",
 						Aliases: []string{"s"},
@@ -205,6 +359,10 @@ func main() {
 						Name:  "start-base64",
 						Usage: "start of the `key` range (base64, inclusive)",
 					},
+					&cli.StringFlag{
+						Name:  "start-hex",
+						Usage: "start of the `key` range (hex, inclusive)",
+					},
 					&cli.StringFlag{
 						Name:    "end",
 						Aliases: []string{"e"},
@@ -219,6 +377,10 @@ func main() {
 						Name:  "end-base64",
 						Usage: "end of the `key` range (base64, exclusive)",
 					},
+					&cli.StringFlag{
+						Name:  "end-hex",
+						Usage: "end of the `key` range (hex, exclusive)",
+					},
 					&cli.StringFlag{
 						Name:    "prefix",
 						Aliases: []string{"p"},
@@ -233,6 +395,10 @@ func main() {
 						Name:  "prefix-base64",
 						Usage: "limit the key range to a range that satisfy the given `prefix` (base64)",
 					},
+					&cli.StringFlag{
+						Name:  "prefix-hex",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (hex)",
+					},
 				},
 				UseShortOptionHandling: true,
 				Action:                 keysCmd,
@@ -258,11 +424,58 @@ func main() {
 						Aliases: []string{"J"},
 						Usage:   "do not pretty-print JSON values",
 					},
+					&cli.BoolFlag{
+						Name:    "hexdump",
+						Aliases: []string{"X"},
+						Usage:   "show values as a hex dump",
+					},
+					&cli.BoolFlag{
+						Name:  "protobuf",
+						Usage: "decode values as protobuf without a schema",
+					},
+					&cli.StringFlag{
+						Name:  "proto-descriptor",
+						Usage: "decode values as protobuf using the FileDescriptorSet in `file`",
+					},
+					&cli.StringFlag{
+						Name:  "proto-type",
+						Usage: "fully-qualified `name` of the protobuf message type of values",
+					},
+					&cli.StringFlag{
+						Name:  "value-codec",
+						Usage: "decode values with the comma-separated `codecs` (msgpack, cbor, bson, gzip, zlib, snappy, auto)",
+					},
 					&cli.BoolFlag{
 						Name:    "no-truncate",
 						Aliases: []string{"w"},
 						Usage:   "do not truncate output",
 					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Value:   "text",
+						Usage:   "output `format` (text, jsonl)",
+					},
+					&cli.StringFlag{
+						Name:  "encoding",
+						Value: "utf8",
+						Usage: "`encoding` of keys and values in JSON Lines output (utf8, base64, hex)",
+					},
+					&cli.StringFlag{
+						Name:    "where",
+						Aliases: []string{"W"},
+						Usage:   "only include entries whose JSON values satisfy the jq-style `expression`",
+					},
+					&cli.StringFlag{
+						Name:    "select",
+						Aliases: []string{"Q"},
+						Usage:   "show the part of JSON values selected by the jq-style `expression`",
+					},
+					&cli.StringFlag{
+						Name:    "template",
+						Aliases: []string{"t"},
+						Usage:   "format each entry with the Go `template`",
+					},
 					&cli.StringFlag{
 						Name:    "start",
 						Aliases: []string{"s"},
@@ -277,6 +490,10 @@ func main() {
 						Name:  "start-base64",
 						Usage: "start of the `key` range (base64, inclusive)",
 					},
+					&cli.StringFlag{
+						Name:  "start-hex",
+						Usage: "start of the `key` range (hex, inclusive)",
+					},
 					&cli.StringFlag{
 						Name:    "end",
 						Aliases: []string{"e"},
@@ -291,6 +508,10 @@ func main() {
 						Name:  "end-base64",
 						Usage: "end of the `key` range (base64, exclusive)",
 					},
+					&cli.StringFlag{
+						Name:  "end-hex",
+						Usage: "end of the `key` range (hex, exclusive)",
+					},
 					&cli.StringFlag{
 						Name:    "prefix",
 						Aliases: []string{"p"},
@@ -305,63 +526,670 @@ func main() {
 						Name:  "prefix-base64",
 						Usage: "limit the key range to a range that satisfy the given `prefix` (base64)",
 					},
+					&cli.StringFlag{
+						Name:  "prefix-hex",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (hex)",
+					},
 				},
 				UseShortOptionHandling: true,
 				Action:                 showCmd,
 			},
 			{
-				Name:      "dump",
-				Usage:     "dump the database as MessagePack",
-				ArgsUsage: "[output]",
+				Name:      "grep",
+				Usage:     "search for entries whose values or keys match the given patterns",
+				ArgsUsage: "<pattern>...",
 				Flags: []cli.Flag{
 					&cli.BoolFlag{
-						Name:    "no-clobber",
-						Aliases: []string{"n"},
-						Usage:   "do not overwrite an existing file",
+						Name:    "fixed-strings",
+						Aliases: []string{"F"},
+						Usage:   "interpret patterns as literal strings with backslash escapes",
 					},
 					&cli.BoolFlag{
-						Name:    "pretty",
+						Name:    "ignore-case",
+						Aliases: []string{"i"},
+						Usage:   "ignore case distinctions in patterns",
+					},
+					&cli.StringFlag{
+						Name:  "search",
+						Value: "value",
+						Usage: "`target` of matching (value, key, both)",
+					},
+					&cli.BoolFlag{
+						Name:    "invert-match",
+						Aliases: []string{"v"},
+						Usage:   "select non-matching entries",
+					},
+					&cli.BoolFlag{
+						Name:    "count",
+						Aliases: []string{"c"},
+						Usage:   "print only the number of matching entries",
+					},
+					&cli.BoolFlag{
+						Name:    "decoded",
+						Aliases: []string{"D"},
+						Usage:   "match decoded values and keys as shown by show instead of raw bytes",
+					},
+					&cli.BoolFlag{
+						Name:  "protobuf",
+						Usage: "decode values as protobuf without a schema",
+					},
+					&cli.StringFlag{
+						Name:  "proto-descriptor",
+						Usage: "decode values as protobuf using the FileDescriptorSet in `file`",
+					},
+					&cli.StringFlag{
+						Name:  "proto-type",
+						Usage: "fully-qualified `name` of the protobuf message type of values",
+					},
+					&cli.StringFlag{
+						Name:  "value-codec",
+						Usage: "decode values with the comma-separated `codecs` (msgpack, cbor, bson, gzip, zlib, snappy, auto)",
+					},
+					&cli.StringFlag{
+						Name:    "start",
+						Aliases: []string{"s"},
+						Usage:   "start of the `key` range (inclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "start-raw",
+						Aliases: []string{"S"},
+						Usage:   "start of the `key` range (no backslash escapes, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "start-base64",
+						Usage: "start of the `key` range (base64, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "start-hex",
+						Usage: "start of the `key` range (hex, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "end",
+						Aliases: []string{"e"},
+						Usage:   "end of the `key` range (exclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "end-raw",
+						Aliases: []string{"E"},
+						Usage:   "end of the `key` range (no backslash escapes, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "end-base64",
+						Usage: "end of the `key` range (base64, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "end-hex",
+						Usage: "end of the `key` range (hex, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "prefix",
 						Aliases: []string{"p"},
-						Usage:   "replace 0x00 characters to show pretty",
+						Usage:   "limit the key range to a range that satisfy the given `prefix`",
+					},
+					&cli.StringFlag{
+						Name:    "prefix-raw",
+						Aliases: []string{"P"},
+						Usage:   "limit the key range to a range that satisfy the given `prefix` (no backslash escapes)",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-base64",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (base64)",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-hex",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (hex)",
 					},
 				},
-				Action: dumpCmd,
+				UseShortOptionHandling: true,
+				Action:                 grepCmd,
 			},
 			{
-				Name:      "load",
-				Usage:     "load MessagePack into the database",
-				ArgsUsage: "[input]",
-				Action:    loadCmd,
+				Name:      "browse",
+				Usage:     "browse keys and values in a terminal UI",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "start",
+						Aliases: []string{"s"},
+						Usage:   "start of the `key` range (inclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "start-raw",
+						Aliases: []string{"S"},
+						Usage:   "start of the `key` range (no backslash escapes, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "start-base64",
+						Usage: "start of the `key` range (base64, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "start-hex",
+						Usage: "start of the `key` range (hex, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "end",
+						Aliases: []string{"e"},
+						Usage:   "end of the `key` range (exclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "end-raw",
+						Aliases: []string{"E"},
+						Usage:   "end of the `key` range (no backslash escapes, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "end-base64",
+						Usage: "end of the `key` range (base64, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "end-hex",
+						Usage: "end of the `key` range (hex, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "prefix",
+						Aliases: []string{"p"},
+						Usage:   "limit the key range to a range that satisfy the given `prefix`",
+					},
+					&cli.StringFlag{
+						Name:    "prefix-raw",
+						Aliases: []string{"P"},
+						Usage:   "limit the key range to a range that satisfy the given `prefix` (no backslash escapes)",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-base64",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (base64)",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-hex",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (hex)",
+					},
+					&cli.BoolFlag{
+						Name:    "hexdump",
+						Aliases: []string{"X"},
+						Usage:   "show values as a hex dump",
+					},
+				},
+				UseShortOptionHandling: true,
+				Action:                 browseCmd,
 			},
 			{
-				Name:      "repair",
-				Usage:     "repair the database",
+				Name:      "shell",
+				Usage:     "run get, put, delete, keys and show interactively",
 				ArgsUsage: " ",
-				Action:    repairCmd,
+				Description: "Commands are read from the standard input. The database is kept open,\n" +
+					"and writes can be grouped with begin, commit and rollback.",
+				Action: shellCmd,
 			},
 			{
-				Name:      "compact",
-				Usage:     "compact the database",
+				Name:      "serve",
+				Usage:     "serve an HTTP/JSON API",
 				ArgsUsage: " ",
-				Action:    compactCmd,
+				Description: "Endpoints:\n" +
+					"   GET    /keys/{key}  get the value for the key\n" +
+					"   GET    /keys        list entries (?start, ?end, ?prefix, ?limit, ?cursor, ?values)\n" +
+					"   GET    /stats       show database statistics\n" +
+					"   PUT    /keys/{key}  set the value for the key to the request body (--writable)\n" +
+					"   DELETE /keys/{key}  delete the key (--writable)\n" +
+					"   POST   /batch       apply operations in JSON Lines format (--writable)\n" +
+					"\n" +
+					"Keys are escaped strings, or encoded with ?encoding=base64 or ?encoding=hex.\n" +
+					"POST /batch requires Content-Type: application/json or application/x-ndjson.",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "listen",
+						Aliases: []string{"l"},
+						Value:   "localhost:8080",
+						Usage:   "listen on `addr`ess",
+					},
+					&cli.BoolFlag{
+						Name:    "writable",
+						Aliases: []string{"w"},
+						Usage:   "enable PUT, DELETE and batch requests",
+					},
+				},
+				Action: serveCmd,
 			},
 			{
-				Name:      "destroy",
-				Usage:     "destroy the database",
+				Name:      "stats",
+				Usage:     "show database statistics",
 				ArgsUsage: " ",
 				Flags: []cli.Flag{
 					&cli.BoolFlag{
-						Name:    "dry-run",
-						Aliases: []string{"n"},
-						Usage:   "do not actually remove; just show what would be removed",
+						Name:    "json",
+						Aliases: []string{"j"},
+						Usage:   "output in JSON",
 					},
 				},
-				Action: destroyCmd,
+				Action: statsCmd,
 			},
-		},
-	}
-
-	if err := app.Run(os.Args); err != nil {
+			{
+				Name:      "analyze",
+				Usage:     "analyze key and value sizes by prefix",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:    "top",
+						Aliases: []string{"n"},
+						Value:   10,
+						Usage:   "show the top `N` prefixes",
+					},
+					&cli.IntFlag{
+						Name:    "prefix-length",
+						Aliases: []string{"l"},
+						Value:   4,
+						Usage:   "group keys by the first `N` bytes",
+					},
+					&cli.StringFlag{
+						Name:    "delimiter",
+						Aliases: []string{"D"},
+						Usage:   "group keys by the part up to the first `delimiter`",
+					},
+					&cli.BoolFlag{
+						Name:    "json",
+						Aliases: []string{"j"},
+						Usage:   "output in JSON",
+					},
+					&cli.StringFlag{
+						Name:    "start",
+						Aliases: []string{"s"},
+						Usage:   "start of the `key` range (inclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "start-raw",
+						Aliases: []string{"S"},
+						Usage:   "start of the `key` range (no backslash escapes, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "start-base64",
+						Usage: "start of the `key` range (base64, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "start-hex",
+						Usage: "start of the `key` range (hex, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "end",
+						Aliases: []string{"e"},
+						Usage:   "end of the `key` range (exclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "end-raw",
+						Aliases: []string{"E"},
+						Usage:   "end of the `key` range (no backslash escapes, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "end-base64",
+						Usage: "end of the `key` range (base64, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "end-hex",
+						Usage: "end of the `key` range (hex, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "prefix",
+						Aliases: []string{"p"},
+						Usage:   "limit the key range to a range that satisfy the given `prefix`",
+					},
+					&cli.StringFlag{
+						Name:    "prefix-raw",
+						Aliases: []string{"P"},
+						Usage:   "limit the key range to a range that satisfy the given `prefix` (no backslash escapes)",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-base64",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (base64)",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-hex",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (hex)",
+					},
+				},
+				UseShortOptionHandling: true,
+				Action:                 analyzeCmd,
+			},
+			{
+				Name:      "sst",
+				Usage:     "inspect a table file",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "raw",
+						Aliases: []string{"r"},
+						Usage:   "do not escape special characters",
+					},
+					&cli.BoolFlag{
+						Name:    "base64",
+						Aliases: []string{"b"},
+						Usage:   "show keys and values in base64 encoding",
+					},
+					&cli.BoolFlag{
+						Name:    "no-json",
+						Aliases: []string{"J"},
+						Usage:   "do not pretty-print JSON values",
+					},
+					&cli.BoolFlag{
+						Name:    "no-truncate",
+						Aliases: []string{"w"},
+						Usage:   "do not truncate output",
+					},
+					&cli.BoolFlag{
+						Name:    "no-entries",
+						Aliases: []string{"n"},
+						Usage:   "do not show the entries of data blocks",
+					},
+				},
+				Action: sstCmd,
+			},
+			{
+				Name:      "wal",
+				Usage:     "decode a journal file",
+				ArgsUsage: "<file>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "raw",
+						Aliases: []string{"r"},
+						Usage:   "do not escape special characters",
+					},
+					&cli.BoolFlag{
+						Name:    "base64",
+						Aliases: []string{"b"},
+						Usage:   "show keys and values in base64 encoding",
+					},
+					&cli.BoolFlag{
+						Name:    "no-json",
+						Aliases: []string{"J"},
+						Usage:   "do not pretty-print JSON values",
+					},
+					&cli.BoolFlag{
+						Name:    "no-truncate",
+						Aliases: []string{"w"},
+						Usage:   "do not truncate output",
+					},
+				},
+				Action: walCmd,
+			},
+			{
+				Name:      "history",
+				Aliases:   []string{"recover-deleted"},
+				Usage:     "show every version of keys found in table and log files",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "raw",
+						Aliases: []string{"r"},
+						Usage:   "do not escape special characters",
+					},
+					&cli.BoolFlag{
+						Name:    "base64",
+						Aliases: []string{"b"},
+						Usage:   "show keys and values in base64 encoding",
+					},
+					&cli.BoolFlag{
+						Name:    "no-json",
+						Aliases: []string{"J"},
+						Usage:   "do not pretty-print JSON values",
+					},
+					&cli.BoolFlag{
+						Name:    "no-truncate",
+						Aliases: []string{"w"},
+						Usage:   "do not truncate output",
+					},
+					&cli.BoolFlag{
+						Name:    "hidden",
+						Aliases: []string{"H"},
+						Usage:   "show only deleted and overwritten versions",
+					},
+					&cli.BoolFlag{
+						Name:    "json",
+						Aliases: []string{"j"},
+						Usage:   "output in JSON Lines",
+					},
+					&cli.StringFlag{
+						Name:    "start",
+						Aliases: []string{"s"},
+						Usage:   "start of the `key` range (inclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "start-raw",
+						Aliases: []string{"S"},
+						Usage:   "start of the `key` range (no backslash escapes, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "start-base64",
+						Usage: "start of the `key` range (base64, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "start-hex",
+						Usage: "start of the `key` range (hex, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "end",
+						Aliases: []string{"e"},
+						Usage:   "end of the `key` range (exclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "end-raw",
+						Aliases: []string{"E"},
+						Usage:   "end of the `key` range (no backslash escapes, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "end-base64",
+						Usage: "end of the `key` range (base64, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "end-hex",
+						Usage: "end of the `key` range (hex, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "prefix",
+						Aliases: []string{"p"},
+						Usage:   "limit the key range to a range that satisfy the given `prefix`",
+					},
+					&cli.StringFlag{
+						Name:    "prefix-raw",
+						Aliases: []string{"P"},
+						Usage:   "limit the key range to a range that satisfy the given `prefix` (no backslash escapes)",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-base64",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (base64)",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-hex",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (hex)",
+					},
+				},
+				UseShortOptionHandling: true,
+				Action:                 historyCmd,
+			},
+			{
+				Name:      "manifest",
+				Usage:     "decode a MANIFEST file",
+				ArgsUsage: "[<file>]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "raw",
+						Aliases: []string{"r"},
+						Usage:   "do not escape special characters",
+					},
+					&cli.BoolFlag{
+						Name:    "base64",
+						Aliases: []string{"b"},
+						Usage:   "show keys in base64 encoding",
+					},
+					&cli.BoolFlag{
+						Name:    "no-edits",
+						Aliases: []string{"n"},
+						Usage:   "show only the final version",
+					},
+				},
+				Action: manifestCmd,
+			},
+			{
+				Name:  "idb",
+				Usage: "inspect Chromium's IndexedDB database",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "schema",
+						Usage:     "show databases, object stores and indexes",
+						ArgsUsage: " ",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "json",
+								Aliases: []string{"j"},
+								Usage:   "output in JSON",
+							},
+						},
+						Action: idbSchemaCmd,
+					},
+					{
+						Name:      "export",
+						Usage:     "export the records of an object store as JSON Lines",
+						ArgsUsage: " ",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "origin",
+								Usage: "`origin` of the database",
+							},
+							&cli.StringFlag{
+								Name:     "database",
+								Aliases:  []string{"D"},
+								Usage:    "`name` of the database",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "object-store",
+								Aliases:  []string{"o"},
+								Usage:    "`name` of the object store",
+								Required: true,
+							},
+						},
+						Action: idbExportCmd,
+					},
+				},
+			},
+			{
+				Name:      "dump",
+				Usage:     "dump the database as MessagePack",
+				ArgsUsage: "[output]",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "no-clobber",
+						Aliases: []string{"n"},
+						Usage:   "do not overwrite an existing file",
+					},
+					&cli.BoolFlag{
+						Name:    "pretty",
+						Aliases: []string{"p"},
+						Usage:   "replace 0x00 characters to show pretty",
+					},
+					&cli.BoolFlag{
+						Name:    "hexdump",
+						Aliases: []string{"X"},
+						Usage:   "show values as a hex dump (with --pretty)",
+					},
+				},
+				Action: dumpCmd,
+			},
+			{
+				Name:      "load",
+				Usage:     "load MessagePack into the database",
+				ArgsUsage: "[input]",
+				Action:    loadCmd,
+			},
+			{
+				Name:      "repair",
+				Usage:     "repair the database",
+				ArgsUsage: " ",
+				Action:    repairCmd,
+			},
+			{
+				Name:      "compact",
+				Usage:     "compact the database",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "rebuild",
+						Usage: "rebuild the database into a new directory and swap it in",
+					},
+					&cli.StringFlag{
+						Name:    "start",
+						Aliases: []string{"s"},
+						Usage:   "start of the `key` range (inclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "start-raw",
+						Aliases: []string{"S"},
+						Usage:   "start of the `key` range (no backslash escapes, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "start-base64",
+						Usage: "start of the `key` range (base64, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "start-hex",
+						Usage: "start of the `key` range (hex, inclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "end",
+						Aliases: []string{"e"},
+						Usage:   "end of the `key` range (exclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "end-raw",
+						Aliases: []string{"E"},
+						Usage:   "end of the `key` range (no backslash escapes, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "end-base64",
+						Usage: "end of the `key` range (base64, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:  "end-hex",
+						Usage: "end of the `key` range (hex, exclusive)",
+					},
+					&cli.StringFlag{
+						Name:    "prefix",
+						Aliases: []string{"p"},
+						Usage:   "limit the key range to a range that satisfy the given `prefix`",
+					},
+					&cli.StringFlag{
+						Name:    "prefix-raw",
+						Aliases: []string{"P"},
+						Usage:   "limit the key range to a range that satisfy the given `prefix` (no backslash escapes)",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-base64",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (base64)",
+					},
+					&cli.StringFlag{
+						Name:  "prefix-hex",
+						Usage: "limit the key range to a range that satisfy the given `prefix` (hex)",
+					},
+				},
+				UseShortOptionHandling: true,
+				Action:                 compactCmd,
+			},
+			{
+				Name:      "destroy",
+				Usage:     "destroy the database",
+				ArgsUsage: " ",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:    "dry-run",
+						Aliases: []string{"n"},
+						Usage:   "do not actually remove; just show what would be removed",
+					},
+				},
+				Action: destroyCmd,
+			},
+		},
+	}
+
+	err := app.RunContext(ctx, os.Args)
+	if snapshotDir != "" {
+		os.RemoveAll(snapshotDir)
+	}
+	if err != nil {
 		if lockFile != "" {
 			os.Remove(lockFile)
 		}
@@ -0,0 +1,219 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cions/leveldb-cli/dbfile"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/urfave/cli/v2"
+)
+
+// currentManifest returns the path of the MANIFEST file named by CURRENT.
+func currentManifest(dbpath string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(dbpath, "CURRENT"))
+	if err != nil {
+		return "", err
+	}
+	name, ok := strings.CutSuffix(string(b), "\n")
+	if !ok || !leveldbFilenamePattern.MatchString(name) || !strings.HasPrefix(name, "MANIFEST-") {
+		return "", fmt.Errorf("%s: invalid CURRENT file", dbpath)
+	}
+	return filepath.Join(dbpath, name), nil
+}
+
+func printFileMeta(rw *recordWriter, prefix string, f *dbfile.FileMeta) error {
+	if _, err := fmt.Printf("%s%06d.ldb size=%d smallest=", prefix, f.Number, f.Size); err != nil {
+		return err
+	}
+	if err := rw.WriteInternalKey(f.Smallest); err != nil {
+		return err
+	}
+	if _, err := os.Stdout.WriteString(" largest="); err != nil {
+		return err
+	}
+	if err := rw.WriteInternalKey(f.Largest); err != nil {
+		return err
+	}
+	_, err := os.Stdout.WriteString("\n")
+	return err
+}
+
+func printVersionEdit(rw *recordWriter, i int, edit *dbfile.VersionEdit) error {
+	if _, err := fmt.Printf("edit #%d:\n", i); err != nil {
+		return err
+	}
+	if edit.Comparer != nil {
+		if _, err := fmt.Printf("  comparer: %s\n", *edit.Comparer); err != nil {
+			return err
+		}
+	}
+	fields := []struct {
+		name  string
+		value *uint64
+	}{
+		{"log number", edit.LogNumber},
+		{"previous log number", edit.PrevLogNumber},
+		{"next file number", edit.NextFileNumber},
+		{"last sequence", edit.LastSequence},
+	}
+	for _, field := range fields {
+		if field.value != nil {
+			if _, err := fmt.Printf("  %s: %d\n", field.name, *field.value); err != nil {
+				return err
+			}
+		}
+	}
+	for _, cp := range edit.CompactPointers {
+		if _, err := fmt.Printf("  compact pointer: level=%d key=", cp.Level); err != nil {
+			return err
+		}
+		if err := rw.WriteInternalKey(cp.Key); err != nil {
+			return err
+		}
+		if _, err := os.Stdout.WriteString("\n"); err != nil {
+			return err
+		}
+	}
+	for _, f := range edit.DeletedFiles {
+		if _, err := fmt.Printf("  delete file: level=%d %06d.ldb\n", f.Level, f.Number); err != nil {
+			return err
+		}
+	}
+	for _, f := range edit.NewFiles {
+		if err := printFileMeta(rw, fmt.Sprintf("  add file: level=%d ", f.Level), &f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortFiles(cmp comparer.Comparer, v *dbfile.Version) {
+	for level, files := range v.Levels {
+		slices.SortFunc(files, func(a, b dbfile.FileMeta) int {
+			if level > 0 {
+				ka, erra := dbfile.ParseInternalKey(a.Smallest)
+				kb, errb := dbfile.ParseInternalKey(b.Smallest)
+				if erra == nil && errb == nil {
+					if n := compareInternalKey(cmp, ka, kb); n != 0 {
+						return n
+					}
+				}
+			}
+			switch {
+			case a.Number < b.Number:
+				return -1
+			case a.Number > b.Number:
+				return 1
+			}
+			return 0
+		})
+	}
+}
+
+func printVersion(rw *recordWriter, v *dbfile.Version) error {
+	if _, err := fmt.Printf("version:\n  comparer: %s\n  log number: %d\n  previous log number: %d\n  next file number: %d\n  last sequence: %d\n",
+		v.Comparer, v.LogNumber, v.PrevLogNumber, v.NextFileNumber, v.LastSequence); err != nil {
+		return err
+	}
+	for level, files := range v.Levels {
+		if len(files) == 0 && v.CompactPointers[level] == nil {
+			continue
+		}
+		var size uint64
+		for _, f := range files {
+			size += f.Size
+		}
+		if _, err := fmt.Printf("  level %d: files=%d size=%d\n", level, len(files), size); err != nil {
+			return err
+		}
+		if v.CompactPointers[level] != nil {
+			if _, err := os.Stdout.WriteString("    compact pointer: "); err != nil {
+				return err
+			}
+			if err := rw.WriteInternalKey(v.CompactPointers[level]); err != nil {
+				return err
+			}
+			if _, err := os.Stdout.WriteString("\n"); err != nil {
+				return err
+			}
+		}
+		for _, f := range files {
+			if err := printFileMeta(rw, "    ", &f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func manifestCmd(c *cli.Context) error {
+	var name string
+	switch c.NArg() {
+	case 0:
+		p, err := currentManifest(c.String("dbpath"))
+		if err != nil {
+			return err
+		}
+		name = p
+	case 1:
+		name = resolveDBFile(c, c.Args().First())
+	default:
+		return usageError(c)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rw, err := newRecordWriter(c)
+	if err != nil {
+		return err
+	}
+	version := new(dbfile.Version)
+	invalid := 0
+	corrupted, err := readJournal(f, os.Stdout, func(i int, data []byte) error {
+		edit, err := dbfile.DecodeVersionEdit(data)
+		if err != nil {
+			invalid++
+			_, err := fmt.Printf("edit #%d: error: %v\n", i, err)
+			return err
+		}
+		version.Apply(edit)
+		if c.Bool("no-edits") {
+			return nil
+		}
+		return printVersionEdit(rw, i, edit)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	cmp, err := lookupComparer(version.Comparer)
+	if err != nil || c.IsSet("indexeddb") {
+		if cmp, err = getComparer(c); err != nil {
+			return err
+		}
+	}
+	sortFiles(cmp, version)
+	if err := printVersion(rw, version); err != nil {
+		return err
+	}
+
+	if corrupted+invalid > 0 {
+		return fmt.Errorf("%s: %d corrupted chunks, %d invalid edits", f.Name(), corrupted, invalid)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestManifestCmd(t *testing.T) {
+	dbpath := newTestDB(t)
+
+	got, err := runCommand(t, &cli.Command{Name: "manifest", Action: manifestCmd}, dbpath)
+	if err != nil {
+		t.Fatalf("manifest: unexpected error: %v", err)
+	}
+	_, version, ok := strings.Cut(got, "version:\n")
+	if !ok {
+		t.Fatalf("manifest output has no final version:\n%s", got)
+	}
+	for _, want := range []string{"  last sequence: 2\n", "  level 1: files=1 "} {
+		if !strings.Contains(version, want) {
+			t.Errorf("manifest version does not contain %q:\n%s", want, version)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/urfave/cli/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var errInvalidWireFormat = errors.New("invalid protobuf wire format")
+
+// protoDecoder renders protobuf-encoded values. If md is nil, values are
+// decoded without a schema.
+type protoDecoder struct {
+	md protoreflect.MessageDescriptor
+}
+
+func loadMessageDescriptor(filename, typeName string) (protoreflect.MessageDescriptor, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	set := new(descriptorpb.FileDescriptorSet)
+	if err := proto.Unmarshal(b, set); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(typeName))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", filename, typeName, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is not a message type", filename, typeName)
+	}
+	return md, nil
+}
+
+// newProtoDecoder returns a protoDecoder configured by --protobuf,
+// --proto-descriptor and --proto-type, or nil if protobuf decoding is not
+// requested.
+func newProtoDecoder(c *cli.Context) (*protoDecoder, error) {
+	switch {
+	case c.IsSet("proto-descriptor") != c.IsSet("proto-type"):
+		return nil, errors.New("options --proto-descriptor and --proto-type must be used together")
+	case c.IsSet("proto-descriptor"):
+		md, err := loadMessageDescriptor(c.String("proto-descriptor"), c.String("proto-type"))
+		if err != nil {
+			return nil, err
+		}
+		return &protoDecoder{md: md}, nil
+	case c.Bool("protobuf"):
+		return &protoDecoder{}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// DecodeJSON decodes b with the message descriptor and returns it as JSON.
+func (d *protoDecoder) DecodeJSON(b []byte) (json.RawMessage, error) {
+	msg := dynamicpb.NewMessage(d.md)
+	if err := proto.Unmarshal(b, msg); err != nil {
+		return nil, err
+	}
+	return protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+}
+
+type wireField struct {
+	Number   uint64
+	WireType int
+	Value    uint64
+	Bytes    []byte
+}
+
+func parseWireFields(b []byte) ([]wireField, error) {
+	var fields []wireField
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 || tag>>3 == 0 || tag>>3 > math.MaxInt32 {
+			return nil, errInvalidWireFormat
+		}
+		b = b[n:]
+
+		field := wireField{Number: tag >> 3, WireType: int(tag & 7)}
+		switch field.WireType {
+		case 0:
+			field.Value, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errInvalidWireFormat
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, errInvalidWireFormat
+			}
+			field.Value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || length > uint64(len(b)-n) {
+				return nil, errInvalidWireFormat
+			}
+			field.Bytes = b[n : n+int(length)]
+			b = b[n+int(length):]
+		case 5:
+			if len(b) < 4 {
+				return nil, errInvalidWireFormat
+			}
+			field.Value = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			return nil, errInvalidWireFormat
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func isPrintableString(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+func writeWireFields(buf *bytes.Buffer, fields []wireField, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, field := range fields {
+		switch field.WireType {
+		case 0:
+			fmt.Fprintf(buf, "%s%d (varint): %d", indent, field.Number, field.Value)
+			if int64(field.Value) < 0 {
+				fmt.Fprintf(buf, " (%d)", int64(field.Value))
+			}
+		case 1:
+			fmt.Fprintf(buf, "%s%d (fixed64): 0x%016x (%g)", indent, field.Number, field.Value, math.Float64frombits(field.Value))
+		case 5:
+			fmt.Fprintf(buf, "%s%d (fixed32): 0x%08x (%g)", indent, field.Number, field.Value, math.Float32frombits(uint32(field.Value)))
+		case 2:
+			if nested, err := parseWireFields(field.Bytes); err == nil && len(nested) > 0 {
+				fmt.Fprintf(buf, "%s%d (message) {\n", indent, field.Number)
+				writeWireFields(buf, nested, depth+1)
+				fmt.Fprintf(buf, "%s}", indent)
+			} else if isPrintableString(field.Bytes) {
+				fmt.Fprintf(buf, "%s%d (string): ", indent, field.Number)
+				newPrettyPrinter(buf).SetQuoting(true).SetColor(false).Write(field.Bytes)
+			} else {
+				fmt.Fprintf(buf, "%s%d (bytes): ", indent, field.Number)
+				newPrettyPrinter(buf).SetQuoting(true).SetColor(false).Write(field.Bytes)
+			}
+		}
+		buf.WriteByte('\n')
+	}
+}
+
+// DecodeRaw decodes b without a schema in a format similar to
+// `protoc --decode_raw`, annotated with wire types.
+func (d *protoDecoder) DecodeRaw(b []byte) (string, error) {
+	fields, err := parseWireFields(b)
+	if err != nil {
+		return "", err
+	}
+	if len(fields) == 0 {
+		return "", errInvalidWireFormat
+	}
+	buf := new(bytes.Buffer)
+	writeWireFields(buf, fields, 0)
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestProtoDecoderJSON(t *testing.T) {
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{{
+			Name:    proto.String("test.proto"),
+			Package: proto.String("test"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("Person"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("name"),
+						JsonName: proto.String("name"),
+						Number:   proto.Int32(1),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					},
+					{
+						Name:     proto.String("user_id"),
+						JsonName: proto.String("userId"),
+						Number:   proto.Int32(2),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					},
+				},
+			}},
+		}},
+	}
+	b, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "test.pb")
+	if err := os.WriteFile(filename, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadMessageDescriptor(filename, "test.Missing"); err == nil {
+		t.Errorf("loadMessageDescriptor(test.Missing) should fail")
+	}
+	md, err := loadMessageDescriptor(filename, "test.Person")
+	if err != nil {
+		t.Fatalf("loadMessageDescriptor: unexpected error: %v", err)
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(md.Fields().ByName("name"), protoreflect.ValueOf("alice"))
+	msg.Set(md.Fields().ByName("user_id"), protoreflect.ValueOf(int32(42)))
+	value, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := (&protoDecoder{md: md}).DecodeJSON(value)
+	if err != nil {
+		t.Fatalf("DecodeJSON: unexpected error: %v", err)
+	}
+	if string(compactJSON(t, got)) != `{"name":"alice","user_id":42}` {
+		t.Errorf("DecodeJSON() = %s", got)
+	}
+}
+
+func TestProtoDecoderRaw(t *testing.T) {
+	cases := []struct {
+		input []byte
+		want  string
+		ok    bool
+	}{
+		{
+			[]byte("\x08\x96\x01\x12\x07testing\x1a\x03\x08\x96\x01\x25\x00\x00\x80\x3f"),
+			"1 (varint): 150\n" +
+				"2 (string): \"testing\"\n" +
+				"3 (message) {\n" +
+				"  1 (varint): 150\n" +
+				"}\n" +
+				"4 (fixed32): 0x3f800000 (1)",
+			true,
+		},
+		{[]byte("\x0a\x02\xff\xfe"), `1 (bytes): "\xff\xfe"`, true},
+		{[]byte("hello"), "", false},
+		{[]byte(""), "", false},
+	}
+
+	for _, tc := range cases {
+		got, err := new(protoDecoder).DecodeRaw(tc.input)
+		if !tc.ok {
+			if err == nil {
+				t.Errorf("DecodeRaw(%q) should fail", tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("DecodeRaw(%q): unexpected error: %v", tc.input, err)
+		} else if got != tc.want {
+			t.Errorf("DecodeRaw(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func compactJSON(t *testing.T, b []byte) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	if err := json.Compact(buf, b); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,794 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/urfave/cli/v2"
+)
+
+// query is a compiled jq-style expression. The supported subset of jq is:
+//
+//   - paths: ., .foo, ."foo", .["foo"], .[0], .foo.bar[0]
+//   - literals: numbers, strings, true, false, null
+//   - operators: |, or, and, ==, !=, <, <=, >, >=, +, -, *, /
+//   - functions: not, length, keys, type, now, tostring, tonumber,
+//     ascii_downcase, ascii_upcase, has(k), test(re), startswith(s),
+//     endswith(s), contains(s)
+//
+// Unlike jq, indexing a value that is not an object or an array yields null
+// instead of an error.
+type query func(v any) (any, error)
+
+type queryToken struct {
+	kind byte // 'f' field, 'i' identifier, 's' string, 'n' number, 'p' punctuation, 0 end
+	text string
+	str  string
+	num  float64
+	pos  int
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z'
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || '0' <= r && r <= '9'
+}
+
+func scanIdent(s string, i int) int {
+	for i < len(s) && isIdentPart(rune(s[i])) {
+		i++
+	}
+	return i
+}
+
+func tokenizeQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '.' && i+1 < len(s) && isIdentStart(rune(s[i+1])):
+			j := scanIdent(s, i+1)
+			tokens = append(tokens, queryToken{kind: 'f', text: s[i:j], str: s[i+1 : j], pos: i})
+			i = j
+		case isIdentStart(r):
+			j := scanIdent(s, i)
+			tokens = append(tokens, queryToken{kind: 'i', text: s[i:j], pos: i})
+			i = j
+		case '0' <= r && r <= '9':
+			j := i
+			for j < len(s) && strings.IndexByte("0123456789.eE", s[j]) >= 0 ||
+				j > i && j < len(s) && (s[j] == '+' || s[j] == '-') && (s[j-1] == 'e' || s[j-1] == 'E') {
+				j++
+			}
+			num, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", s[i:j], i)
+			}
+			tokens = append(tokens, queryToken{kind: 'n', text: s[i:j], num: num, pos: i})
+			i = j
+		case r == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			var str string
+			if err := json.Unmarshal([]byte(s[i:j+1]), &str); err != nil {
+				return nil, fmt.Errorf("invalid string at position %d", i)
+			}
+			tokens = append(tokens, queryToken{kind: 's', text: s[i : j+1], str: str, pos: i})
+			i = j + 1
+		default:
+			text := string(r)
+			for _, op := range []string{"==", "!=", "<=", ">="} {
+				if strings.HasPrefix(s[i:], op) {
+					text = op
+				}
+			}
+			if !strings.Contains(text, "=") && strings.IndexRune(".[]()|;<>+-*/?", r) < 0 {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+			}
+			tokens = append(tokens, queryToken{kind: 'p', text: text, pos: i})
+			i += len(text)
+		}
+	}
+	return append(tokens, queryToken{pos: len(s)}), nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != 0 {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is the given punctuation or keyword.
+func (p *queryParser) accept(text string) bool {
+	if tok := p.peek(); (tok.kind == 'p' || tok.kind == 'i') && tok.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *queryParser) unexpected() error {
+	tok := p.peek()
+	if tok.kind == 0 {
+		return errors.New("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+}
+
+// compileQuery compiles a jq-style expression.
+func compileQuery(s string) (query, error) {
+	tokens, err := tokenizeQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	q, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != 0 {
+		return nil, p.unexpected()
+	}
+	return q, nil
+}
+
+func (p *queryParser) parsePipe() (query, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("|") {
+		right, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		left = pipeQuery(left, right)
+	}
+	return left, nil
+}
+
+func pipeQuery(left, right query) query {
+	return func(v any) (any, error) {
+		v, err := left(v)
+		if err != nil {
+			return nil, err
+		}
+		return right(v)
+	}
+}
+
+func (p *queryParser) parseOr() (query, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalQuery(left, right, true)
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (query, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalQuery(left, right, false)
+	}
+	return left, nil
+}
+
+// logicalQuery returns "left or right" if or is true, or "left and right"
+// otherwise. right is not evaluated if left determines the result.
+func logicalQuery(left, right query, or bool) query {
+	return func(v any) (any, error) {
+		l, err := left(v)
+		if err != nil {
+			return nil, err
+		}
+		if isTruthy(l) == or {
+			return or, nil
+		}
+		r, err := right(v)
+		if err != nil {
+			return nil, err
+		}
+		return isTruthy(r), nil
+	}
+}
+
+var comparisonOperators = map[string]func(c int) bool{
+	"==": func(c int) bool { return c == 0 },
+	"!=": func(c int) bool { return c != 0 },
+	"<":  func(c int) bool { return c < 0 },
+	"<=": func(c int) bool { return c <= 0 },
+	">":  func(c int) bool { return c > 0 },
+	">=": func(c int) bool { return c >= 0 },
+}
+
+func (p *queryParser) parseComparison() (query, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	op, ok := comparisonOperators[tok.text]
+	if tok.kind != 'p' || !ok {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	return binaryQuery(left, right, func(l, r any) (any, error) {
+		return op(compareValues(l, r)), nil
+	}), nil
+}
+
+func binaryQuery(left, right query, fn func(l, r any) (any, error)) query {
+	return func(v any) (any, error) {
+		l, err := left(v)
+		if err != nil {
+			return nil, err
+		}
+		r, err := right(v)
+		if err != nil {
+			return nil, err
+		}
+		return fn(l, r)
+	}
+}
+
+func (p *queryParser) parseAdditive() (query, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var fn func(l, r any) (any, error)
+		switch {
+		case p.accept("+"):
+			fn = addValues
+		case p.accept("-"):
+			fn = arithmetic("-", func(a, b float64) float64 { return a - b })
+		default:
+			return left, nil
+		}
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryQuery(left, right, fn)
+	}
+}
+
+func (p *queryParser) parseMultiplicative() (query, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var fn func(l, r any) (any, error)
+		switch {
+		case p.accept("*"):
+			fn = arithmetic("*", func(a, b float64) float64 { return a * b })
+		case p.accept("/"):
+			fn = func(l, r any) (any, error) {
+				if r == 0.0 {
+					return nil, errors.New("division by zero")
+				}
+				return arithmetic("/", func(a, b float64) float64 { return a / b })(l, r)
+			}
+		default:
+			return left, nil
+		}
+		right, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryQuery(left, right, fn)
+	}
+}
+
+func (p *queryParser) parsePostfix() (query, error) {
+	q, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch tok := p.peek(); {
+		case tok.kind == 'f':
+			p.next()
+			q = pipeQuery(q, indexQuery(constQuery(tok.str)))
+		case tok.kind == 'p' && tok.text == "." && p.tokens[p.pos+1].kind == 's':
+			p.next()
+			q = pipeQuery(q, indexQuery(constQuery(p.next().str)))
+		case p.accept("["):
+			index, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			q = pipeQuery(q, indexQuery(index))
+		case p.accept("?"):
+		default:
+			return q, nil
+		}
+	}
+}
+
+func (p *queryParser) parseTerm() (query, error) {
+	tok := p.next()
+	switch tok.kind {
+	case 'f':
+		return indexQuery(constQuery(tok.str)), nil
+	case 's':
+		return constQuery(tok.str), nil
+	case 'n':
+		return constQuery(tok.num), nil
+	case 'i':
+		return p.parseFunction(tok)
+	case 'p':
+		switch tok.text {
+		case ".":
+			if p.peek().kind == 's' {
+				return indexQuery(constQuery(p.next().str)), nil
+			}
+			return identityQuery, nil
+		case "(":
+			q, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return q, nil
+		case "-":
+			q, err := p.parsePostfix()
+			if err != nil {
+				return nil, err
+			}
+			return binaryQuery(constQuery(0.0), q, arithmetic("-", func(a, b float64) float64 { return a - b })), nil
+		}
+	}
+	if tok.kind != 0 {
+		p.pos--
+	}
+	return nil, p.unexpected()
+}
+
+var queryFunctions = map[string]func(v any) (any, error){
+	"not": func(v any) (any, error) {
+		return !isTruthy(v), nil
+	},
+	"length": func(v any) (any, error) {
+		switch v := v.(type) {
+		case nil:
+			return 0.0, nil
+		case bool:
+			return nil, errors.New("boolean has no length")
+		case float64:
+			return math.Abs(v), nil
+		case string:
+			return float64(utf8.RuneCountInString(v)), nil
+		case []any:
+			return float64(len(v)), nil
+		case map[string]any:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("unexpected type %T", v)
+	},
+	"keys": func(v any) (any, error) {
+		switch v := v.(type) {
+		case []any:
+			keys := make([]any, len(v))
+			for i := range v {
+				keys[i] = float64(i)
+			}
+			return keys, nil
+		case map[string]any:
+			names := make([]string, 0, len(v))
+			for name := range v {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			keys := make([]any, len(names))
+			for i, name := range names {
+				keys[i] = name
+			}
+			return keys, nil
+		}
+		return nil, fmt.Errorf("%s has no keys", typeName(v))
+	},
+	"type": func(v any) (any, error) {
+		return typeName(v), nil
+	},
+	"now": func(v any) (any, error) {
+		return float64(time.Now().UnixNano()) / 1e9, nil
+	},
+	"tostring": func(v any) (any, error) {
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"tonumber": func(v any) (any, error) {
+		switch v := v.(type) {
+		case float64:
+			return v, nil
+		case string:
+			return strconv.ParseFloat(strings.TrimSpace(v), 64)
+		}
+		return nil, fmt.Errorf("%s cannot be parsed as a number", typeName(v))
+	},
+	"ascii_downcase": stringFunction(func(s string) any { return strings.ToLower(s) }),
+	"ascii_upcase":   stringFunction(func(s string) any { return strings.ToUpper(s) }),
+}
+
+var queryFunctions1 = map[string]func(v, arg any) (any, error){
+	"has": func(v, arg any) (any, error) {
+		switch v := v.(type) {
+		case map[string]any:
+			if k, ok := arg.(string); ok {
+				_, ok := v[k]
+				return ok, nil
+			}
+		case []any:
+			if i, ok := arg.(float64); ok {
+				return 0 <= i && i < float64(len(v)), nil
+			}
+		}
+		return nil, fmt.Errorf("cannot check whether %s has a %s key", typeName(v), typeName(arg))
+	},
+	"test": stringFunction1(func(s, arg string) (any, error) {
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString(s), nil
+	}),
+	"startswith": stringFunction1(func(s, arg string) (any, error) {
+		return strings.HasPrefix(s, arg), nil
+	}),
+	"endswith": stringFunction1(func(s, arg string) (any, error) {
+		return strings.HasSuffix(s, arg), nil
+	}),
+	"contains": stringFunction1(func(s, arg string) (any, error) {
+		return strings.Contains(s, arg), nil
+	}),
+}
+
+func stringFunction(fn func(s string) any) func(v any) (any, error) {
+	return func(v any) (any, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a string", typeName(v))
+		}
+		return fn(s), nil
+	}
+}
+
+func stringFunction1(fn func(s, arg string) (any, error)) func(v, arg any) (any, error) {
+	return func(v, arg any) (any, error) {
+		s, ok1 := v.(string)
+		a, ok2 := arg.(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%s and %s cannot be used as strings", typeName(v), typeName(arg))
+		}
+		return fn(s, a)
+	}
+}
+
+func (p *queryParser) parseFunction(tok queryToken) (query, error) {
+	switch tok.text {
+	case "true":
+		return constQuery(true), nil
+	case "false":
+		return constQuery(false), nil
+	case "null":
+		return constQuery(nil), nil
+	}
+	if fn, ok := queryFunctions[tok.text]; ok {
+		return fn, nil
+	}
+	fn, ok := queryFunctions1[tok.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", tok.text, tok.pos)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	arg, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return func(v any) (any, error) {
+		a, err := arg(v)
+		if err != nil {
+			return nil, err
+		}
+		return fn(v, a)
+	}, nil
+}
+
+func identityQuery(v any) (any, error) {
+	return v, nil
+}
+
+func constQuery(c any) query {
+	return func(any) (any, error) {
+		return c, nil
+	}
+}
+
+func indexQuery(index query) query {
+	return func(v any) (any, error) {
+		i, err := index(v)
+		if err != nil {
+			return nil, err
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			if k, ok := i.(string); ok {
+				return v[k], nil
+			}
+		case []any:
+			if n, ok := i.(float64); ok {
+				n := int(math.Floor(n))
+				if n < 0 {
+					n += len(v)
+				}
+				if 0 <= n && n < len(v) {
+					return v[n], nil
+				}
+			}
+		}
+		return nil, nil
+	}
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func isTruthy(v any) bool {
+	return v != nil && v != false
+}
+
+// typeOrder returns the rank of the type of v in jq's sort order.
+func typeOrder(v any) int {
+	switch v {
+	case nil:
+		return 0
+	case false:
+		return 1
+	case true:
+		return 2
+	}
+	switch v.(type) {
+	case float64:
+		return 3
+	case string:
+		return 4
+	case []any:
+		return 5
+	default:
+		return 6
+	}
+}
+
+// compareValues compares JSON values in jq's sort order.
+func compareValues(a, b any) int {
+	if c := cmp.Compare(typeOrder(a), typeOrder(b)); c != 0 {
+		return c
+	}
+	switch a := a.(type) {
+	case float64:
+		return cmp.Compare(a, b.(float64))
+	case string:
+		return strings.Compare(a, b.(string))
+	case []any:
+		return slices.CompareFunc(a, b.([]any), compareValues)
+	case map[string]any:
+		b := b.(map[string]any)
+		ka, _ := queryFunctions["keys"](a)
+		kb, _ := queryFunctions["keys"](b)
+		if c := compareValues(ka, kb); c != 0 {
+			return c
+		}
+		for _, k := range ka.([]any) {
+			if c := compareValues(a[k.(string)], b[k.(string)]); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func addValues(l, r any) (any, error) {
+	switch {
+	case l == nil:
+		return r, nil
+	case r == nil:
+		return l, nil
+	}
+	switch l := l.(type) {
+	case string:
+		if r, ok := r.(string); ok {
+			return l + r, nil
+		}
+	case []any:
+		if r, ok := r.([]any); ok {
+			return slices.Concat(l, r), nil
+		}
+	}
+	return arithmetic("+", func(a, b float64) float64 { return a + b })(l, r)
+}
+
+func arithmetic(op string, fn func(a, b float64) float64) func(l, r any) (any, error) {
+	return func(l, r any) (any, error) {
+		a, ok1 := l.(float64)
+		b, ok2 := r.(float64)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("%s and %s cannot be used with %s", typeName(l), typeName(r), op)
+		}
+		return fn(a, b), nil
+	}
+}
+
+// valueFilter applies --where and --select to values parsed as JSON, or as
+// IndexedDB values with --indexeddb.
+type valueFilter struct {
+	where     query
+	selector  query
+	indexedDB bool
+	codec     codecChain
+}
+
+// newValueFilter returns a valueFilter configured by --where and --select, or
+// nil if neither is given.
+func newValueFilter(c *cli.Context) (*valueFilter, error) {
+	if c.String("where") == "" && c.String("select") == "" {
+		return nil, nil
+	}
+	f := &valueFilter{indexedDB: c.Bool("indexeddb")}
+	if s := c.String("where"); s != "" {
+		q, err := compileQuery(s)
+		if err != nil {
+			return nil, fmt.Errorf("option --where: %w", err)
+		}
+		f.where = q
+	}
+	if s := c.String("select"); s != "" {
+		q, err := compileQuery(s)
+		if err != nil {
+			return nil, fmt.Errorf("option --select: %w", err)
+		}
+		f.selector = q
+	}
+	codec, err := newCodecChain(c)
+	if err != nil {
+		return nil, err
+	}
+	f.codec = codec
+	return f, nil
+}
+
+func (f *valueFilter) parse(key, value []byte) (any, bool) {
+	if f.indexedDB {
+		if obj, err := decodeIndexedDBValue(key, value); err == nil {
+			if b, err := json.Marshal(obj); err == nil {
+				value = b
+			}
+		}
+	}
+	if len(f.codec) > 0 {
+		if decoded, obj, err := f.codec.Decode(value); err == nil && obj != nil {
+			value = obj
+		} else if err == nil {
+			value = decoded
+		}
+	}
+	_, obj, ok := parseJSONValue(value)
+	return obj, ok
+}
+
+// Apply reports whether the entry satisfies --where and returns the value
+// projected by --select as JSON. Values that are not JSON never match.
+func (f *valueFilter) Apply(key, value []byte) ([]byte, bool) {
+	v, ok := f.parse(key, value)
+	if !ok {
+		return nil, false
+	}
+	if f.where != nil {
+		if r, err := f.where(v); err != nil || !isTruthy(r) {
+			return nil, false
+		}
+	}
+	if f.selector == nil {
+		return value, true
+	}
+	r, err := f.selector(v)
+	if err != nil {
+		return nil, false
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
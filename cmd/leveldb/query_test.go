@@ -0,0 +1,135 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	input := `{"user":{"name":"alice","tags":["a","b"]},"expires":1600000000,"n":null,"weird key":true}`
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{`.`, `{"expires":1600000000,"n":null,"user":{"name":"alice","tags":["a","b"]},"weird key":true}`},
+		{`.user.name`, `"alice"`},
+		{`.user["name"]`, `"alice"`},
+		{`."weird key"`, `true`},
+		{`.["weird key"]`, `true`},
+		{`.user.tags[1]`, `"b"`},
+		{`.user.tags[-1]`, `"b"`},
+		{`.user.tags[5]`, `null`},
+		{`.missing.deeply`, `null`},
+		{`.expires.foo`, `null`},
+		{`.expires < 1700000000`, `true`},
+		{`.expires >= 1700000000`, `false`},
+		{`.user.name == "alice" and .n == null`, `true`},
+		{`.n or .expires > 0`, `true`},
+		{`.n | not`, `true`},
+		{`.expires - 600000000 * 2 + 1`, `400000001`},
+		{`-.expires / 2`, `-800000000`},
+		{`.user.tags | length`, `2`},
+		{`.user | keys`, `["name","tags"]`},
+		{`.user | has("tags")`, `true`},
+		{`.user.name | test("^a.i")`, `true`},
+		{`.user.name | startswith("al") and endswith("ce")`, `true`},
+		{`.user.name | ascii_upcase`, `"ALICE"`},
+		{`.user.name + "!"`, `"alice!"`},
+		{`.expires | tostring | contains("1600")`, `true`},
+		{`(.n | type) == "null"`, `true`},
+		{`1 < "a" and "a" < .user.tags and .user.tags < .user and null < false`, `true`},
+		{`"1e3" | tonumber`, `1000`},
+	}
+
+	var v any
+	if err := json.Unmarshal([]byte(input), &v); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range cases {
+		q, err := compileQuery(tc.expr)
+		if err != nil {
+			t.Errorf("compileQuery(%q): unexpected error: %v", tc.expr, err)
+			continue
+		}
+		result, err := q(v)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.expr, err)
+			continue
+		}
+		got, err := json.Marshal(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s = %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestCompileQueryError(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`.a <`,
+		`.a ==== 1`,
+		`.a[0`,
+		`foo`,
+		`has(1`,
+		`"unterminated`,
+		`.a & .b`,
+	} {
+		if _, err := compileQuery(expr); err == nil {
+			t.Errorf("compileQuery(%q) should fail", expr)
+		}
+	}
+}
+
+func TestValueFilter(t *testing.T) {
+	where, err := compileQuery(`.expires < 100`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selector, err := compileQuery(`.name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &valueFilter{where: where, selector: selector}
+
+	cases := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{`{"name":"a","expires":1}`, `"a"`, true},
+		{`"{\"name\":\"b\",\"expires\":2}"`, `"b"`, true},
+		{`{"name":"c","expires":200}`, ``, false},
+		{`not json`, ``, false},
+	}
+	for _, tc := range cases {
+		got, ok := f.Apply([]byte("key"), []byte(tc.value))
+		if ok != tc.ok || string(got) != tc.want {
+			t.Errorf("Apply(%q) = %q, %v, want %q, %v", tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+
+	// A missing field is null, which sorts before numbers as in jq, so
+	// the README example guards against it.
+	for _, tc := range []struct {
+		where string
+		ok    bool
+	}{
+		{`.expires < 100`, true},
+		{`.expires != null and .expires < 100`, false},
+	} {
+		where, err := compileQuery(tc.where)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := &valueFilter{where: where}
+		if _, ok := f.Apply([]byte("key"), []byte(`{"name":"d"}`)); ok != tc.ok {
+			t.Errorf("%s: Apply(value without the field) = %v, want %v", tc.where, ok, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	defaultScanLimit = 100
+	maxScanLimit     = 1000
+	maxRequestBody   = 64 * opt.MiB
+)
+
+// apiServer serves the HTTP/JSON API. All requests share one database handle.
+//
+//	GET    /keys/{key}  get the value for the key
+//	GET    /keys        list entries in a key range
+//	GET    /stats       show database statistics
+//	PUT    /keys/{key}  set the value for the key to the request body (--writable)
+//	DELETE /keys/{key}  delete the key (--writable)
+//	POST   /batch       apply operations in JSON Lines format (--writable)
+//
+// Keys in paths, query parameters and responses are escaped strings, or
+// base64- or hex-encoded with ?encoding=base64 or ?encoding=hex. Base64 uses
+// the URL-safe alphabet without padding, but the standard alphabet is also
+// accepted. Key paths are used as is, without the cleaning of "." and ".."
+// segments and repeated slashes done by http.ServeMux.
+//
+// To protect a local server from web pages, requests must name the server by
+// an IP address, localhost or the listen host, which defeats DNS rebinding.
+// Writes are refused if the Origin header names another site, and POST /batch
+// requires a JSON content type, which browsers cannot send cross-origin
+// without a CORS preflight.
+type apiServer struct {
+	db         *leveldb.DB
+	cmp        comparer.Comparer
+	indexedDB  bool
+	listenHost string
+	mux        *http.ServeMux
+	keyMethods map[string]http.Handler
+}
+
+// apiError is an error with an HTTP status code.
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, a ...any) error {
+	return &apiError{http.StatusBadRequest, fmt.Errorf(format, a...)}
+}
+
+type scanResponse struct {
+	Entries []any  `json:"entries"`
+	Next    string `json:"next,omitempty"`
+}
+
+// newAPIServer returns the API handler. listenHost is the host part of the
+// listen address, which is accepted in the Host header besides IP addresses
+// and localhost.
+func newAPIServer(db *leveldb.DB, cmp comparer.Comparer, writable, indexedDB bool, listenHost string) http.Handler {
+	s := &apiServer{db: db, cmp: cmp, indexedDB: indexedDB, listenHost: listenHost}
+	s.mux = http.NewServeMux()
+	s.mux.Handle("GET /keys", apiHandler(s.scan))
+	s.mux.Handle("GET /stats", apiHandler(s.stats))
+	s.keyMethods = map[string]http.Handler{
+		http.MethodGet:  apiHandler(s.get),
+		http.MethodHead: apiHandler(s.get),
+	}
+	if writable {
+		s.mux.Handle("POST /batch", sameOrigin(s.batch))
+		s.keyMethods[http.MethodPut] = sameOrigin(s.put)
+		s.keyMethods[http.MethodDelete] = sameOrigin(s.delete)
+	}
+	return s
+}
+
+func (s *apiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkHost(r); err != nil {
+		apiHandler(func(*http.Request) (any, error) { return nil, err }).ServeHTTP(w, r)
+		return
+	}
+	if key, ok := strings.CutPrefix(r.URL.EscapedPath(), "/keys/"); ok {
+		s.serveKey(w, r, key)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// serveKey dispatches requests for /keys/{key}. The mux is bypassed because
+// it redirects paths with "." and ".." segments, which may be part of keys.
+func (s *apiServer) serveKey(w http.ResponseWriter, r *http.Request, escapedKey string) {
+	h, ok := s.keyMethods[r.Method]
+	if !ok {
+		var allow []string
+		for method := range s.keyMethods {
+			allow = append(allow, method)
+		}
+		slices.Sort(allow)
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		h = apiHandler(func(*http.Request) (any, error) {
+			return nil, &apiError{http.StatusMethodNotAllowed, errors.New("method not allowed")}
+		})
+	}
+	key, err := url.PathUnescape(escapedKey)
+	if err != nil {
+		h = apiHandler(func(*http.Request) (any, error) { return nil, badRequest("key: %w", err) })
+	}
+	r.SetPathValue("key", key)
+	h.ServeHTTP(w, r)
+}
+
+// checkHost rejects requests for host names other than localhost and the
+// listen host, as sent by a browser whose DNS was rebound to this server.
+func (s *apiServer) checkHost(r *http.Request) error {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if net.ParseIP(host) != nil || strings.EqualFold(host, "localhost") || (s.listenHost != "" && strings.EqualFold(host, s.listenHost)) {
+		return nil
+	}
+	return &apiError{http.StatusForbidden, fmt.Errorf("host %q is not allowed", host)}
+}
+
+// sameOrigin wraps a handler of a write request to reject requests from web
+// pages of other origins.
+func sameOrigin(f apiHandler) apiHandler {
+	return func(r *http.Request) (any, error) {
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Host != r.Host {
+				return nil, &apiError{http.StatusForbidden, fmt.Errorf("origin %q is not allowed", origin)}
+			}
+		}
+		return f(r)
+	}
+}
+
+// apiHandler writes the result of f as JSON, or an error object. A nil result
+// is written as 204 No Content.
+type apiHandler func(r *http.Request) (any, error)
+
+func (f apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+	result, err := f(r)
+
+	status := http.StatusOK
+	var apiErr *apiError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.status
+	case errors.Is(err, leveldb.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.As(err, &maxBytesErr):
+		status = http.StatusRequestEntityTooLarge
+	case err != nil:
+		status = http.StatusInternalServerError
+	case result == nil:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		result = map[string]string{"error": err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(result)
+}
+
+// codec returns the key decoder and the writer of records for the encoding
+// given by the query parameters.
+func (s *apiServer) codec(r *http.Request) (func([]byte) ([]byte, error), *jsonlWriter, error) {
+	name := r.URL.Query().Get("encoding")
+	if name == "" {
+		name = "utf8"
+	}
+	decode, ok := byteDecoders[name]
+	if !ok {
+		return nil, nil, badRequest("unknown encoding %q", name)
+	}
+	encode := byteEncodings[name]
+	if name == "base64" {
+		decode, encode = decodeURLBase64, base64.RawURLEncoding.EncodeToString
+	}
+	parseJSON := true
+	if v := r.URL.Query().Get("json"); v != "" {
+		var err error
+		if parseJSON, err = strconv.ParseBool(v); err != nil {
+			return nil, nil, badRequest("parameter json: %w", err)
+		}
+	}
+	return decode, &jsonlWriter{
+		encode:    encode,
+		parseJSON: parseJSON,
+		indexedDB: s.indexedDB,
+	}, nil
+}
+
+// decodeURLBase64 decodes base64 in either the URL-safe or the standard
+// alphabet, with or without padding.
+func decodeURLBase64(b []byte) ([]byte, error) {
+	b = bytes.Map(func(r rune) rune {
+		switch r {
+		case '-':
+			return '+'
+		case '_':
+			return '/'
+		}
+		return r
+	}, b)
+	return decodeBase64(b)
+}
+
+func (s *apiServer) pathKey(r *http.Request, decode func([]byte) ([]byte, error)) ([]byte, error) {
+	key, err := decode([]byte(r.PathValue("key")))
+	if err != nil {
+		return nil, badRequest("key: %w", err)
+	}
+	return key, nil
+}
+
+func (s *apiServer) get(r *http.Request) (any, error) {
+	decode, jw, err := s.codec(r)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.pathKey(r, decode)
+	if err != nil {
+		return nil, err
+	}
+	value, err := s.db.Get(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return jsonlRecord{Key: jw.encode(key), Value: jw.value(key, value)}, nil
+}
+
+// scanRange returns the key range given by the start, end and prefix query
+// parameters, with the same semantics as the range options.
+func (s *apiServer) scanRange(r *http.Request, decode func([]byte) ([]byte, error)) (*util.Range, error) {
+	q := r.URL.Query()
+	param := func(name string) ([]byte, error) {
+		if !q.Has(name) {
+			return nil, nil
+		}
+		b, err := decode([]byte(q.Get(name)))
+		if err != nil {
+			return nil, badRequest("parameter %s: %w", name, err)
+		}
+		return b, nil
+	}
+
+	if q.Has("prefix") {
+		prefix, err := param("prefix")
+		if err != nil {
+			return nil, err
+		}
+		return prefixRange(prefix, s.indexedDB), nil
+	}
+	start, err := param("start")
+	if err != nil {
+		return nil, err
+	}
+	end, err := param("end")
+	if err != nil {
+		return nil, err
+	}
+	return &util.Range{Start: start, Limit: end}, nil
+}
+
+func (s *apiServer) scan(r *http.Request) (any, error) {
+	q := r.URL.Query()
+	decode, jw, err := s.codec(r)
+	if err != nil {
+		return nil, err
+	}
+	slice, err := s.scanRange(r, decode)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := defaultScanLimit
+	if q.Has("limit") {
+		if limit, err = strconv.Atoi(q.Get("limit")); err != nil || limit <= 0 || limit > maxScanLimit {
+			return nil, badRequest("parameter limit: must be between 1 and %d", maxScanLimit)
+		}
+	}
+	values := true
+	if q.Has("values") {
+		if values, err = strconv.ParseBool(q.Get("values")); err != nil {
+			return nil, badRequest("parameter values: %w", err)
+		}
+	}
+
+	iter := s.db.NewIterator(slice, nil)
+	defer iter.Release()
+
+	ok := iter.First()
+	if q.Has("cursor") {
+		cursor, err := base64.RawURLEncoding.DecodeString(q.Get("cursor"))
+		if err != nil {
+			return nil, badRequest("parameter cursor: %w", err)
+		}
+		ok = iter.Seek(cursor)
+	}
+
+	resp := &scanResponse{Entries: []any{}}
+	for ; ok; ok = iter.Next() {
+		if len(resp.Entries) == limit {
+			resp.Next = base64.RawURLEncoding.EncodeToString(iter.Key())
+			break
+		}
+		if values {
+			resp.Entries = append(resp.Entries, jsonlRecord{Key: jw.encode(iter.Key()), Value: jw.value(iter.Key(), iter.Value())})
+		} else {
+			resp.Entries = append(resp.Entries, jsonlKeyRecord{Key: jw.encode(iter.Key())})
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (s *apiServer) stats(r *http.Request) (any, error) {
+	return readStats(s.db)
+}
+
+func (s *apiServer) put(r *http.Request) (any, error) {
+	decode, _, err := s.codec(r)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.pathKey(r, decode)
+	if err != nil {
+		return nil, err
+	}
+	value, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.db.Put(key, value, nil)
+}
+
+func (s *apiServer) delete(r *http.Request) (any, error) {
+	decode, _, err := s.codec(r)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.pathKey(r, decode)
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.db.Delete(key, nil)
+}
+
+func (s *apiServer) batch(r *http.Request) (any, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json", "application/jsonl", "application/x-ndjson":
+	default:
+		return nil, &apiError{http.StatusUnsupportedMediaType, errors.New("content type must be application/json or application/x-ndjson")}
+	}
+
+	decode, _, err := s.codec(r)
+	if err != nil {
+		return nil, err
+	}
+	dryRun := false
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			return nil, badRequest("parameter dryRun: %w", err)
+		}
+	}
+	ops, err := parseBatchJSONL(r.Body, decode)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, err
+		}
+		return nil, badRequest("%w", err)
+	}
+	return applyBatch(s.db, s.cmp, ops, dryRun)
+}
+
+func serveCmd(c *cli.Context) error {
+	writable := c.Bool("writable")
+	if writable && c.Bool("copy") {
+		return fmt.Errorf("option --writable cannot be used with --copy")
+	}
+
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
+		Comparer:       cmp,
+		ErrorIfMissing: true,
+		ReadOnly:       !writable,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ln, err := net.Listen("tcp", c.String("listen"))
+	if err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(c.String("listen"))
+	if err != nil {
+		return fmt.Errorf("option --listen: %w", err)
+	}
+	srv := &http.Server{Handler: newAPIServer(db, cmp, writable, c.Bool("indexeddb"), host)}
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt)
+	defer stop()
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdown <- srv.Shutdown(context.Background())
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening on http://%s\n", ln.Addr())
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	if err := <-shutdown; err != nil {
+		return err
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
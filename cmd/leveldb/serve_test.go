@@ -0,0 +1,203 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+)
+
+func newTestAPIServer(t *testing.T, writable bool) *httptest.Server {
+	db, err := leveldb.OpenFile(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for key, value := range map[string]string{
+		"a":      "1",
+		"user:1": `{"name":"alice"}`,
+		"user:2": "bob",
+		"user:3": "\x00\xff",
+		"z\x00":  "",
+		// "+/+/" in standard base64
+		"\xfb\xff\xbf": "x",
+	} {
+		if err := db.Put([]byte(key), []byte(value), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := httptest.NewServer(newAPIServer(db, comparer.DefaultComparer, writable, false, "localhost"))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// doRequest sends a request with the given header fields, given as pairs of
+// names and values.
+func doRequest(t *testing.T, method, url, body string, header ...string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		if header[i] == "Host" {
+			req.Host = header[i+1]
+		} else {
+			req.Header.Set(header[i], header[i+1])
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, strings.TrimSuffix(string(b), "\n")
+}
+
+func TestAPIServerRead(t *testing.T) {
+	srv := newTestAPIServer(t, false)
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+		want   string
+	}{
+		{"GET", "/keys/user:1", 200, `{"key":"user:1","value":{"name":"alice"}}`},
+		{"GET", "/keys/user:1?json=false", 200, `{"key":"user:1","value":"{\"name\":\"alice\"}"}`},
+		{"GET", "/keys/user:3", 200, `{"key":"user:3","value":"\\0\\xff"}`},
+		{"GET", "/keys/dXNlcjoy?encoding=base64", 200, `{"key":"dXNlcjoy","value":"Ym9i"}`},
+		{"GET", "/keys/-_-_?encoding=base64", 200, `{"key":"-_-_","value":"eA"}`},
+		{"GET", "/keys/+/+/?encoding=base64", 200, `{"key":"-_-_","value":"eA"}`},
+		{"GET", "/keys?start=-_-_&encoding=base64&values=false", 200, `{"entries":[{"key":"-_-_"}]}`},
+		{"GET", "/keys/z%5C0", 200, `{"key":"z\\0","value":""}`},
+		{"GET", "/keys/missing", 404, `{"error":"leveldb: not found"}`},
+		{"GET", "/keys/x?encoding=rot13", 400, `{"error":"unknown encoding \"rot13\""}`},
+		{"GET", "/keys?prefix=user:&values=false", 200, `{"entries":[{"key":"user:1"},{"key":"user:2"},{"key":"user:3"}]}`},
+		{"GET", "/keys?start=user:2&end=z&values=false", 200, `{"entries":[{"key":"user:2"},{"key":"user:3"}]}`},
+		{"GET", "/keys?start=b&end=c", 200, `{"entries":[]}`},
+		{"GET", "/keys?limit=0", 400, `{"error":"parameter limit: must be between 1 and 1000"}`},
+		{"PUT", "/keys/a", 405, ``},
+		{"POST", "/batch", 404, ``},
+	}
+	for _, tc := range cases {
+		status, body := doRequest(t, tc.method, srv.URL+tc.path, "")
+		if status != tc.status || (tc.want != "" && body != tc.want) {
+			t.Errorf("%s %s = %d %s, want %d %s", tc.method, tc.path, status, body, tc.status, tc.want)
+		}
+	}
+
+	var keys []string
+	cursor := ""
+	for range 5 {
+		status, body := doRequest(t, "GET", srv.URL+"/keys?limit=2&values=false"+cursor, "")
+		if status != 200 {
+			t.Fatalf("GET /keys: %d %s", status, body)
+		}
+		var resp struct {
+			Entries []jsonlKeyRecord
+			Next    string
+		}
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range resp.Entries {
+			keys = append(keys, entry.Key)
+		}
+		if resp.Next == "" {
+			break
+		}
+		cursor = "&cursor=" + resp.Next
+	}
+	if got, want := strings.Join(keys, " "), `a user:1 user:2 user:3 z\0 \xfb\xff\xbf`; got != want {
+		t.Errorf("paginated keys = %s, want %s", got, want)
+	}
+
+	if status, body := doRequest(t, "GET", srv.URL+"/stats", ""); status != 200 || !strings.Contains(body, `"leveldb.stats"`) {
+		t.Errorf("GET /stats = %d %s", status, body)
+	}
+}
+
+func TestAPIServerWrite(t *testing.T) {
+	srv := newTestAPIServer(t, true)
+
+	steps := []struct {
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}{
+		{"PUT", "/keys/new%20key", "v\x00", 204, ``},
+		{"GET", "/keys/new%20key", "", 200, `{"key":"new key","value":"v\\0"}`},
+		{"PUT", "/keys/a/../b", "dots", 204, ``},
+		{"GET", "/keys/a/../b", "", 200, `{"key":"a/../b","value":"dots"}`},
+		{"GET", "/keys/b", "", 404, `{"error":"leveldb: not found"}`},
+		{"PUT", "/keys/.//.", "slashes", 204, ``},
+		{"DELETE", "/keys/.//.", "", 204, ``},
+		{"DELETE", "/keys/a", "", 204, ``},
+		{"GET", "/keys/a", "", 404, `{"error":"leveldb: not found"}`},
+		{"POST", "/batch?dryRun=true", `{"op":"delete-range","start":"user:","end":"user;"}`, 200, `{"put":0,"delete":0,"deleteRange":1,"rangeDeleted":3}`},
+		{"POST", "/batch", `{"key":"b","value":{"x":1}}` + "\n" + `{"op":"delete","key":"user:1"}`, 200, `{"put":1,"delete":1,"deleteRange":0,"rangeDeleted":0}`},
+		{"POST", "/batch", `{"op":"get"}`, 400, `{"error":"record 1: unknown op \"get\""}`},
+		{"GET", "/keys?values=false", "", 200, `{"entries":[{"key":"a/../b"},{"key":"b"},{"key":"new key"},{"key":"user:2"},{"key":"user:3"},{"key":"z\\0"},{"key":"\\xfb\\xff\\xbf"}]}`},
+	}
+	for _, step := range steps {
+		status, body := doRequest(t, step.method, srv.URL+step.path, step.body, "Content-Type", "application/x-ndjson")
+		if status != step.status || body != step.want {
+			t.Errorf("%s %s = %d %s, want %d %s", step.method, step.path, status, body, step.status, step.want)
+		}
+	}
+}
+
+func TestAPIServerCrossOrigin(t *testing.T) {
+	srv := newTestAPIServer(t, true)
+	deleteAll := `{"op":"delete-range","start":""}`
+
+	cases := []struct {
+		method string
+		path   string
+		body   string
+		header []string
+		status int
+	}{
+		{"POST", "/batch", deleteAll, []string{"Content-Type", "text/plain", "Origin", "http://evil.example"}, 403},
+		{"POST", "/batch", deleteAll, []string{"Content-Type", "application/json", "Origin", "http://evil.example"}, 403},
+		{"POST", "/batch", deleteAll, []string{"Content-Type", "text/plain"}, 415},
+		{"POST", "/batch", deleteAll, []string{"Content-Type", "application/json", "Origin", "null"}, 403},
+		{"DELETE", "/keys/a", "", []string{"Origin", "http://evil.example"}, 403},
+		{"PUT", "/keys/a", "x", []string{"Origin", "http://evil.example"}, 403},
+		{"GET", "/keys/a", "", []string{"Host", "evil.example"}, 403},
+		{"POST", "/batch", deleteAll, []string{"Content-Type", "application/json", "Host", "evil.example:8080"}, 403},
+		{"GET", "/keys/a", "", []string{"Host", "localhost:8080"}, 200},
+		{"GET", "/keys/a", "", []string{"Host", "[::1]:8080"}, 200},
+	}
+	for _, tc := range cases {
+		if status, body := doRequest(t, tc.method, srv.URL+tc.path, tc.body, tc.header...); status != tc.status {
+			t.Errorf("%s %s %q = %d %s, want %d", tc.method, tc.path, tc.header, status, body, tc.status)
+		}
+	}
+
+	status, body := doRequest(t, "GET", srv.URL+"/keys?values=false", "")
+	if want := `{"entries":[{"key":"a"},{"key":"user:1"},{"key":"user:2"},{"key":"user:3"},{"key":"z\\0"},{"key":"\\xfb\\xff\\xbf"}]}`; status != 200 || body != want {
+		t.Errorf("GET /keys = %d %s, want 200 %s", status, body, want)
+	}
+
+	if status, body := doRequest(t, "PUT", srv.URL+"/keys/a", "2", "Origin", srv.URL); status != 204 {
+		t.Errorf("same-origin PUT = %d %s, want 204", status, body)
+	}
+}
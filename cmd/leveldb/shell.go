@@ -0,0 +1,531 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+// shellCommands are the commands of the main application available in the
+// shell.
+var shellCommands = []string{"get", "put", "delete", "keys", "show"}
+
+// shellKeyCommands are the commands whose arguments are completed as keys.
+var shellKeyCommands = []string{"get", "put", "delete", "cd"}
+
+const maxCompletionCandidates = 100
+
+type shellSession struct {
+	app       *cli.App
+	db        *leveldb.DB
+	tr        *leveldb.Transaction
+	indexedDB bool
+
+	// prefix is set by cd, and scope by cd and use.
+	prefix []byte
+	scope  *util.Range
+
+	history []string
+	exited  bool
+	out     io.Writer
+}
+
+func shellSessionOf(c *cli.Context) *shellSession {
+	s, _ := c.App.Metadata["shell"].(*shellSession)
+	return s
+}
+
+// usageError shows the help of the command and exits with status 2. In the
+// shell, it returns an error instead of exiting.
+func usageError(c *cli.Context) error {
+	if shellSessionOf(c) == nil {
+		cli.ShowSubcommandHelpAndExit(c, 2)
+	}
+	if err := cli.ShowSubcommandHelp(c); err != nil {
+		return err
+	}
+	return errors.New("invalid arguments")
+}
+
+func newShellSession(parent *cli.App, db *leveldb.DB, indexedDB bool) *shellSession {
+	s := &shellSession{db: db, indexedDB: indexedDB, out: os.Stdout}
+
+	var commands []*cli.Command
+	for _, name := range shellCommands {
+		if cmd := parent.Command(name); cmd != nil {
+			cmd := *cmd
+			cmd.HelpName = ""
+			commands = append(commands, &cmd)
+		}
+	}
+
+	var rangeFlags []cli.Flag
+	if cmd := parent.Command("keys"); cmd != nil {
+		for _, flag := range cmd.Flags {
+			if slices.Contains(keyRangeFlagNames, flag.Names()[0]) {
+				rangeFlags = append(rangeFlags, flag)
+			}
+		}
+	}
+
+	commands = append(commands,
+		&cli.Command{
+			Name:      "cd",
+			Usage:     "limit subsequent commands to keys with the given prefix",
+			ArgsUsage: "[<prefix>]",
+			Description: "Keys given to get, put and delete become relative to the prefix,\n" +
+				"and keys, show and delete without range options list only keys with it.\n" +
+				"Without arguments, the scope is cleared.",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:    "raw",
+					Aliases: []string{"r"},
+					Usage:   "do not interpret backslash escapes",
+				},
+				&cli.BoolFlag{
+					Name:    "base64",
+					Aliases: []string{"b"},
+					Usage:   "interpret arguments as base64-encoded",
+				},
+				&cli.BoolFlag{
+					Name:    "hex",
+					Aliases: []string{"x"},
+					Usage:   "interpret arguments as hex-encoded",
+				},
+			},
+			UseShortOptionHandling: true,
+			Action:                 s.cdCmd,
+		},
+		&cli.Command{
+			Name:      "use",
+			Usage:     "limit subsequent commands to the given range",
+			ArgsUsage: " ",
+			Description: "keys, show and delete without range options list only keys in the range.\n" +
+				"Without options, the scope is cleared.",
+			Flags:                  rangeFlags,
+			UseShortOptionHandling: true,
+			Action:                 s.useCmd,
+		},
+		&cli.Command{
+			Name:      "begin",
+			Usage:     "begin a transaction",
+			ArgsUsage: " ",
+			Action:    s.beginCmd,
+		},
+		&cli.Command{
+			Name:      "commit",
+			Usage:     "commit the transaction",
+			ArgsUsage: " ",
+			Action:    s.commitCmd,
+		},
+		&cli.Command{
+			Name:      "rollback",
+			Usage:     "discard the transaction",
+			ArgsUsage: " ",
+			Action:    s.rollbackCmd,
+		},
+		&cli.Command{
+			Name:      "history",
+			Usage:     "show the command history",
+			ArgsUsage: " ",
+			Action:    s.historyCmd,
+		},
+		&cli.Command{
+			Name:      "exit",
+			Aliases:   []string{"quit"},
+			Usage:     "exit the shell",
+			ArgsUsage: " ",
+			Action: func(c *cli.Context) error {
+				s.exited = true
+				return nil
+			},
+		},
+	)
+
+	s.app = &cli.App{
+		Name:      "leveldb",
+		Usage:     "run commands on the open database",
+		UsageText: "command [command options] [arguments...]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:   "indexeddb",
+				Hidden: true,
+			},
+		},
+		HideVersion:    true,
+		Commands:       commands,
+		Metadata:       map[string]any{"shell": s},
+		ExitErrHandler: func(*cli.Context, error) {},
+	}
+	s.app.Setup()
+	return s
+}
+
+// handle returns the transaction if one is in progress, or the database.
+func (s *shellSession) handle() dbHandle {
+	if s.tr != nil {
+		return s.tr
+	}
+	return s.db
+}
+
+// Prompt returns the prompt showing the scope and whether a transaction is in
+// progress.
+func (s *shellSession) Prompt() string {
+	var sb strings.Builder
+	sb.WriteString("leveldb")
+	if len(s.prefix) > 0 {
+		sb.WriteString(":" + escape(s.prefix))
+	} else if s.scope != nil {
+		fmt.Fprintf(&sb, "[%s,%s)", escape(s.scope.Start), escape(s.scope.Limit))
+	}
+	if s.tr != nil {
+		sb.WriteString("*")
+	}
+	sb.WriteString("> ")
+	return sb.String()
+}
+
+// Exec runs a command line.
+func (s *shellSession) Exec(line string) error {
+	args, err := splitBatchLine(line)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	s.history = append(s.history, line)
+	if s.app.Command(args[0]) == nil {
+		return fmt.Errorf("unknown command %q; try \"help\"", args[0])
+	}
+
+	argv := []string{s.app.Name}
+	if s.indexedDB {
+		argv = append(argv, "--indexeddb")
+	}
+	return s.app.Run(append(argv, args...))
+}
+
+// Close discards the transaction in progress, if any.
+func (s *shellSession) Close() error {
+	if s.tr == nil {
+		return nil
+	}
+	s.tr.Discard()
+	s.tr = nil
+	_, err := fmt.Fprintln(os.Stderr, "leveldb: uncommitted transaction discarded")
+	return err
+}
+
+func (s *shellSession) cdCmd(c *cli.Context) error {
+	if c.NArg() > 1 {
+		return usageError(c)
+	}
+	prefix, err := getArg(c, 0)
+	if err != nil {
+		return err
+	}
+	if len(prefix) == 0 {
+		s.prefix, s.scope = nil, nil
+		return nil
+	}
+	s.prefix = prefix
+	s.scope = prefixRange(prefix, s.indexedDB)
+	return nil
+}
+
+func (s *shellSession) useCmd(c *cli.Context) error {
+	if c.NArg() > 0 {
+		return usageError(c)
+	}
+	s.prefix, s.scope = nil, nil
+	if !hasKeyRange(c) {
+		return nil
+	}
+	slice, err := getKeyRange(c)
+	if err != nil {
+		return err
+	}
+	s.scope = slice
+	return nil
+}
+
+func (s *shellSession) beginCmd(c *cli.Context) error {
+	if s.tr != nil {
+		return errors.New("a transaction is already in progress")
+	}
+	tr, err := s.db.OpenTransaction()
+	if err != nil {
+		return err
+	}
+	s.tr = tr
+	return nil
+}
+
+func (s *shellSession) commitCmd(c *cli.Context) error {
+	if s.tr == nil {
+		return errors.New("no transaction in progress")
+	}
+	if err := s.tr.Commit(); err != nil {
+		return err
+	}
+	s.tr = nil
+	return nil
+}
+
+func (s *shellSession) rollbackCmd(c *cli.Context) error {
+	if s.tr == nil {
+		return errors.New("no transaction in progress")
+	}
+	s.tr.Discard()
+	s.tr = nil
+	return nil
+}
+
+func (s *shellSession) historyCmd(c *cli.Context) error {
+	for i, line := range s.history {
+		if _, err := fmt.Fprintf(s.out, "%5d  %s\n", i+1, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentWord returns the start of the word ending at the end of line, taking
+// quoted fields into account.
+func currentWord(line string) int {
+	start, quoted := 0, false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case quoted && line[i] == '\\':
+			i++
+		case line[i] == '"' && (quoted || i == start):
+			quoted = !quoted
+		case !quoted && strings.ContainsRune(" \t", rune(line[i])):
+			start = i + 1
+		}
+	}
+	return start
+}
+
+// quoteWord quotes s if it cannot be given as a bare word. The closing quote
+// is added only if closed is true, so that the completion can be continued.
+func quoteWord(s string, force, closed bool) string {
+	if !force && !strings.ContainsAny(s, " \t") && !strings.HasPrefix(s, `"`) {
+		return s
+	}
+	s = `"` + strings.ReplaceAll(s, `"`, `\"`)
+	if closed {
+		s += `"`
+	}
+	return s
+}
+
+// Complete completes command names and keys. Keys are looked up with an
+// iterator of the database or the transaction in progress. It implements
+// term.Terminal.AutoCompleteCallback.
+func (s *shellSession) Complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	head, tail := line[:pos], line[pos:]
+	start := currentWord(head)
+	word := head[start:]
+	fields, err := splitBatchLine(head[:start])
+	if err != nil {
+		return "", 0, false
+	}
+
+	var candidates []string
+	var completion string
+	var unique bool
+	if len(fields) == 0 {
+		for _, cmd := range s.app.VisibleCommands() {
+			if strings.HasPrefix(cmd.Name, word) {
+				candidates = append(candidates, cmd.Name)
+			}
+		}
+		if len(candidates) == 0 {
+			return "", 0, false
+		}
+		completion = candidates[0]
+		for _, name := range candidates[1:] {
+			for !strings.HasPrefix(name, completion) {
+				completion = completion[:len(completion)-1]
+			}
+		}
+		unique = len(candidates) == 1
+	} else {
+		cmd := s.app.Command(fields[0])
+		if cmd == nil || !slices.Contains(shellKeyCommands, cmd.Name) || strings.HasPrefix(word, "-") {
+			return "", 0, false
+		}
+		quoted := strings.HasPrefix(word, `"`)
+		partial, err := unescape([]byte(strings.TrimPrefix(word, `"`)))
+		if err != nil {
+			return "", 0, false
+		}
+		var base []byte
+		if cmd.Name != "cd" {
+			base = s.prefix
+		}
+
+		keys, err := s.completeKeys(append(bytes.Clone(base), partial...))
+		if err != nil || len(keys) == 0 {
+			return "", 0, false
+		}
+		common := keys[0][len(base):]
+		for _, k := range keys[1:] {
+			k = k[len(base):]
+			n := 0
+			for n < len(common) && n < len(k) && common[n] == k[n] {
+				n++
+			}
+			common = common[:n]
+		}
+		for _, k := range keys {
+			candidates = append(candidates, escape(k[len(base):]))
+		}
+		unique = len(keys) == 1
+		completion = quoteWord(escape(common), quoted, unique)
+		if !unique && len(common) == len(partial) {
+			completion = word
+		}
+	}
+
+	if unique {
+		completion += " "
+	} else if completion == word {
+		if len(candidates) == maxCompletionCandidates {
+			candidates = append(candidates, "...")
+		}
+		fmt.Fprintln(s.out, strings.Join(candidates, "  "))
+		return "", 0, false
+	}
+	return head[:start] + completion + tail, start + len(completion), true
+}
+
+// completeKeys returns up to maxCompletionCandidates keys starting with
+// prefix.
+func (s *shellSession) completeKeys(prefix []byte) ([][]byte, error) {
+	var keys [][]byte
+	iter := s.handle().NewIterator(prefixRange(prefix, s.indexedDB), nil)
+	defer iter.Release()
+	for len(keys) < maxCompletionCandidates && iter.Next() {
+		if bytes.HasPrefix(iter.Key(), prefix) {
+			keys = append(keys, bytes.Clone(iter.Key()))
+		}
+	}
+	return keys, iter.Error()
+}
+
+// interact reads commands from the terminal with line editing, history and
+// completion.
+func (s *shellSession) interact(fd int) error {
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, "")
+	t.AutoCompleteCallback = s.Complete
+	s.out = t
+
+	for !s.exited {
+		if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+			t.SetSize(width, height)
+		}
+		t.SetPrompt(s.Prompt())
+
+		// The terminal is in raw mode only while reading a line, so that
+		// the output of commands is not garbled.
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		line, err := t.ReadLine()
+		if err := term.Restore(fd, state); err != nil {
+			return err
+		}
+		if err == io.EOF {
+			fmt.Println()
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		s.out = os.Stdout
+		if err := s.Exec(line); err != nil {
+			fmt.Fprintf(os.Stderr, "leveldb: error: %v\n", err)
+		}
+		s.out = t
+	}
+	return nil
+}
+
+// runScript runs commands read from r, stopping at the first error.
+func (s *shellSession) runScript(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*opt.MiB)
+	for lineno := 1; !s.exited && scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		if trimmed := strings.TrimSpace(line); trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+		if err := s.Exec(line); err != nil {
+			return fmt.Errorf("line %d: %w", lineno, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func shellCmd(c *cli.Context) error {
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
+		Comparer:       cmp,
+		ErrorIfMissing: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	s := newShellSession(c.App, db, c.Bool("indexeddb"))
+	defer s.Close()
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) && term.IsTerminal(int(os.Stdout.Fd())) {
+		err = s.interact(fd)
+	} else {
+		err = s.runScript(os.Stdin)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	return nil
+}
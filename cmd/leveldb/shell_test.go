@@ -0,0 +1,130 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/urfave/cli/v2"
+)
+
+func newTestShellSession(t *testing.T) *shellSession {
+	db, err := leveldb.OpenFile(filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	parent := &cli.App{
+		Commands: []*cli.Command{
+			{Name: "get", Action: getCmd},
+			{Name: "put", Action: putCmd},
+			{Name: "delete", Action: deleteCmd},
+		},
+	}
+	s := newShellSession(parent, db, false)
+	s.out = io.Discard
+	s.app.Writer = io.Discard
+	return s
+}
+
+func TestShellSession(t *testing.T) {
+	s := newTestShellSession(t)
+
+	dump := func() string {
+		var entries []string
+		iter := s.db.NewIterator(nil, nil)
+		defer iter.Release()
+		for iter.Next() {
+			entries = append(entries, string(iter.Key())+"="+string(iter.Value()))
+		}
+		return strings.Join(entries, " ")
+	}
+
+	for _, line := range []string{
+		"put a 1",
+		"cd user:",
+		"put 1 alice",
+		`put "2 x" bob`,
+		"begin",
+		"put 3 carol",
+		"delete 1",
+		"rollback",
+		"begin",
+		"put 4 dave",
+		"commit",
+		"cd",
+		"put b 2",
+	} {
+		if err := s.Exec(line); err != nil {
+			t.Fatalf("%s: unexpected error: %v", line, err)
+		}
+	}
+	if got, want := dump(), "a=1 b=2 user:1=alice user:2 x=bob user:4=dave"; got != want {
+		t.Errorf("database = %s, want %s", got, want)
+	}
+
+	for _, line := range []string{"commit", "rollback", "unknown", "put", `put "a`} {
+		if err := s.Exec(line); err == nil {
+			t.Errorf("%s should fail", line)
+		}
+	}
+
+	if err := s.Exec("begin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Exec("cd user:"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Prompt(), "leveldb:user:*> "; got != want {
+		t.Errorf("Prompt() = %q, want %q", got, want)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShellComplete(t *testing.T) {
+	s := newTestShellSession(t)
+	for _, key := range []string{"user:1", "user:2 x", "user:10", "\"q"} {
+		if err := s.db.Put([]byte(key), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{"ge", "get ", true},
+		{"x", "", false},
+		{"get us", "get user:", true},
+		{"get user:", "", false},
+		{"get user:1", "get user:1", false},
+		{"get user:2", `get "user:2 x" `, true},
+		{`get "user:2`, `get "user:2 x" `, true},
+		{`get \"`, `get "\"q" `, true},
+		{"get -", "", false},
+		{"cd u", "cd user:", true},
+		{"put user:10 ", "", false},
+	}
+	for _, tc := range cases {
+		got, pos, ok := s.Complete(tc.line, len(tc.line), '\t')
+		if ok != tc.ok || (ok && (got != tc.want || pos != len(got))) {
+			t.Errorf("Complete(%q) = %q, %d, %v, want %q, %v", tc.line, got, pos, ok, tc.want, tc.ok)
+		}
+	}
+
+	if err := s.Exec("cd user:"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := s.Complete("get 2", 5, '\t'); got != `get "2 x" ` {
+		t.Errorf("Complete(%q) in user: = %q, want %q", "get 2", got, `get "2 x" `)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+
+	"github.com/cions/leveldb-cli/dbfile"
+	"github.com/urfave/cli/v2"
+)
+
+const snapshotAttempts = 5
+
+var errSnapshotChanged = errors.New("database changed while copying")
+
+var readOnlyCommands = []string{
+	"get",
+	"keys",
+	"show",
+	"dump",
+	"stats",
+	"analyze",
+	"sst",
+	"wal",
+	"manifest",
+	"history",
+	"idb",
+	"grep",
+	"browse",
+	"serve",
+}
+
+// contextCommands stop on their own when their context is cancelled.
+var contextCommands = []string{
+	"serve",
+}
+
+// selectedCommand returns the command to be run, or nil if it is unknown.
+func selectedCommand(c *cli.Context) *cli.Command {
+	name := c.Args().First()
+	if name == "" {
+		name = c.App.DefaultCommand
+	}
+	return c.App.Command(name)
+}
+
+func checkReadOnlyCommand(c *cli.Context) error {
+	cmd := selectedCommand(c)
+	if cmd == nil {
+		return nil
+	}
+	if !slices.Contains(readOnlyCommands, cmd.Name) {
+		return fmt.Errorf("option --copy cannot be used with the %s command", cmd.Name)
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	defer df.Close()
+
+	if _, err := io.Copy(df, sf); err != nil {
+		return err
+	}
+	if err := df.Close(); err != nil {
+		return err
+	}
+	return sf.Close()
+}
+
+// copyDataFiles copies the table and log files in src that do not exist in
+// dst yet.
+func copyDataFiles(src, dst string) error {
+	names, err := readDirNames(src)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if !dataFilenamePattern.MatchString(name) {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(dst, name)); err == nil {
+			continue
+		}
+		err := copyFile(filepath.Join(src, name), filepath.Join(dst, name))
+		if errors.Is(err, fs.ErrNotExist) && filepath.Ext(name) != ".log" {
+			return fmt.Errorf("%s: %w", name, errSnapshotChanged)
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func readVersion(manifest string) (*dbfile.Version, error) {
+	f, err := os.Open(manifest)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	version := new(dbfile.Version)
+	if _, err := readJournal(f, io.Discard, func(i int, data []byte) error {
+		edit, err := dbfile.DecodeVersionEdit(data)
+		if err != nil {
+			return err
+		}
+		version.Apply(edit)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// copySnapshot copies a consistent set of database files from src to dst.
+// The MANIFEST and CURRENT are copied last, and errSnapshotChanged is
+// returned if the database was modified in a way that invalidates the copy.
+func copySnapshot(src, dst string) error {
+	manifest, err := currentManifest(src)
+	if err != nil {
+		return err
+	}
+
+	if err := copyDataFiles(src, dst); err != nil {
+		return err
+	}
+
+	dstManifest := filepath.Join(dst, filepath.Base(manifest))
+	if err := copyFile(manifest, dstManifest); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", filepath.Base(manifest), errSnapshotChanged)
+	} else if err != nil {
+		return err
+	}
+
+	// Tables and logs created while copying are referenced by the copied
+	// MANIFEST, so pick them up before checking that nothing is missing.
+	if err := copyDataFiles(src, dst); err != nil {
+		return err
+	}
+	version, err := readVersion(dstManifest)
+	if err != nil {
+		return err
+	}
+	for _, files := range version.Levels {
+		for _, f := range files {
+			ldb := filepath.Join(dst, fmt.Sprintf("%06d.ldb", f.Number))
+			sst := filepath.Join(dst, fmt.Sprintf("%06d.sst", f.Number))
+			if _, err := os.Lstat(ldb); err == nil {
+				continue
+			}
+			if _, err := os.Lstat(sst); err == nil {
+				continue
+			}
+			return fmt.Errorf("table %06d: %w", f.Number, errSnapshotChanged)
+		}
+	}
+
+	if current, err := currentManifest(src); err != nil {
+		return err
+	} else if current != manifest {
+		return fmt.Errorf("CURRENT: %w", errSnapshotChanged)
+	}
+	name := filepath.Base(manifest) + "\n"
+	return os.WriteFile(filepath.Join(dst, "CURRENT"), []byte(name), 0o644)
+}
+
+// snapshotDB copies the database into a new temporary directory and returns
+// its path. The copy is retried if the database changes while copying.
+func snapshotDB(dbpath string) (string, error) {
+	var err error
+	for range snapshotAttempts {
+		var dir string
+		dir, err = os.MkdirTemp("", "leveldb-snapshot-")
+		if err != nil {
+			return "", err
+		}
+		if err = copySnapshot(dbpath, dir); err == nil {
+			return dir, nil
+		}
+		os.RemoveAll(dir)
+		if !errors.Is(err, errSnapshotChanged) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%s: %w (gave up after %d attempts)", dbpath, err, snapshotAttempts)
+}
+
+// removeOnSignal removes dir and exits when the process is interrupted or its
+// output is closed. For contextCommands, cancel is called instead so that the
+// command can shut down gracefully, and dir is left for the caller to remove
+// once the command returns.
+func removeOnSignal(c *cli.Context, dir string, cancel context.CancelFunc) {
+	cmd := selectedCommand(c)
+	graceful := cmd != nil && slices.Contains(contextCommands, cmd.Name)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM, syscall.SIGPIPE)
+	go func() {
+		<-ch
+		if graceful {
+			signal.Stop(ch)
+			cancel()
+			return
+		}
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}()
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func TestSnapshotDB(t *testing.T) {
+	dbpath := filepath.Join(t.TempDir(), "db")
+	db, err := leveldb.OpenFile(dbpath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := db.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("old"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.CompactRange(util.Range{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i += 2 {
+		if err := db.Put([]byte(fmt.Sprintf("key%03d", i)), []byte("new"), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The database is still open and locked.
+	dir, err := snapshotDB(dbpath)
+	if err != nil {
+		t.Fatalf("snapshotDB: unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	sdb, err := leveldb.OpenFile(dir, &opt.Options{ErrorIfMissing: true, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("OpenFile: unexpected error: %v", err)
+	}
+	defer sdb.Close()
+
+	for i := 0; i < 100; i++ {
+		want := "old"
+		if i%2 == 0 {
+			want = "new"
+		}
+		got, err := sdb.Get([]byte(fmt.Sprintf("key%03d", i)), nil)
+		if err != nil {
+			t.Fatalf("Get: unexpected error: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("key%03d = %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/cions/leveldb-cli/dbfile"
+	"github.com/fatih/color"
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/urfave/cli/v2"
+)
+
+// resolveDBFile resolves name relative to the database directory if it does
+// not exist relative to the current directory.
+func resolveDBFile(c *cli.Context, name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	if _, err := os.Stat(name); errors.Is(err, fs.ErrNotExist) {
+		return filepath.Join(c.String("dbpath"), name)
+	}
+	return name
+}
+
+func (rw *recordWriter) WriteInternalKey(b []byte) error {
+	ikey, err := dbfile.ParseInternalKey(b)
+	if err != nil {
+		if err := rw.WriteKey(b); err != nil {
+			return err
+		}
+		_, err := fmt.Printf(" (%v)", err)
+		return err
+	}
+	if err := rw.WriteKey(ikey.UserKey); err != nil {
+		return err
+	}
+	_, err = fmt.Printf(" seq=%d %v", ikey.Seq, ikey.Kind)
+	return err
+}
+
+func compareInternalKey(cmp comparer.Comparer, a, b *dbfile.InternalKey) int {
+	if n := cmp.Compare(a.UserKey, b.UserKey); n != 0 {
+		return n
+	}
+	switch {
+	case a.Seq > b.Seq:
+		return -1
+	case a.Seq < b.Seq:
+		return 1
+	}
+	return 0
+}
+
+func printBlockEntries(rw *recordWriter, cmp comparer.Comparer, block *dbfile.Block, prev *dbfile.InternalKey) (*dbfile.InternalKey, error) {
+	for _, entry := range block.Entries {
+		if _, err := os.Stdout.WriteString("  "); err != nil {
+			return prev, err
+		}
+		if err := rw.WriteInternalKey(entry.Key); err != nil {
+			return prev, err
+		}
+		ikey, err := dbfile.ParseInternalKey(entry.Key)
+		if err == nil && ikey.Kind == dbfile.KindPut {
+			if _, err := os.Stdout.WriteString(rw.Separator()); err != nil {
+				return prev, err
+			}
+			if err := rw.WriteValue(ikey.UserKey, entry.Value); err != nil {
+				return prev, err
+			}
+		}
+		if err == nil && prev != nil && compareInternalKey(cmp, prev, ikey) >= 0 {
+			if _, err := os.Stdout.WriteString(" (out of order)"); err != nil {
+				return prev, err
+			}
+		}
+		if _, err := os.Stdout.WriteString("\n"); err != nil {
+			return prev, err
+		}
+		if err == nil {
+			prev = ikey
+		}
+	}
+	return prev, nil
+}
+
+func sstCmd(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return usageError(c)
+	}
+
+	f, err := os.Open(resolveDBFile(c, c.Args().First()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	t, err := dbfile.OpenTable(f, fi.Size())
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.Name(), err)
+	}
+
+	rw, err := newRecordWriter(c)
+	if err != nil {
+		return err
+	}
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Printf("footer: metaindex=%d+%d index=%d+%d\n",
+		t.Footer.MetaIndex.Offset, t.Footer.MetaIndex.Length,
+		t.Footer.Index.Offset, t.Footer.Index.Length); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Println("metaindex:"); err != nil {
+		return err
+	}
+	for _, entry := range t.MetaIndex {
+		if _, err := os.Stdout.WriteString("  "); err != nil {
+			return err
+		}
+		if _, err := newPrettyPrinter(color.Output).SetQuoting(true).Write(entry.Key); err != nil {
+			return err
+		}
+		if _, err := fmt.Printf(" -> %d+%d\n", entry.Handle.Offset, entry.Handle.Length); err != nil {
+			return err
+		}
+	}
+
+	policy := t.FilterPolicy()
+	if policy == "" {
+		policy = "(none)"
+	}
+	if _, err := fmt.Printf("filter policy: %s\n", policy); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Printf("index: compression=%v blocks=%d\n", t.IndexCompression, len(t.Index)); err != nil {
+		return err
+	}
+	for _, entry := range t.Index {
+		if _, err := os.Stdout.WriteString("  "); err != nil {
+			return err
+		}
+		if err := rw.WriteInternalKey(entry.Key); err != nil {
+			return err
+		}
+		if _, err := fmt.Printf(" -> %d+%d\n", entry.Handle.Offset, entry.Handle.Length); err != nil {
+			return err
+		}
+	}
+
+	var prev *dbfile.InternalKey
+	corrupted := 0
+	for i, entry := range t.Index {
+		block, err := t.ReadBlock(entry.Handle)
+		if err != nil {
+			corrupted++
+			if _, err := fmt.Printf("block #%d: %d+%d: error: %v\n", i, entry.Handle.Offset, entry.Handle.Length, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Printf("block #%d: %d+%d compression=%v entries=%d restarts=%d\n",
+			i, entry.Handle.Offset, entry.Handle.Length, block.Compression, len(block.Entries), block.Restarts); err != nil {
+			return err
+		}
+		if c.Bool("no-entries") {
+			continue
+		}
+		if prev, err = printBlockEntries(rw, cmp, block, prev); err != nil {
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if corrupted > 0 {
+		return fmt.Errorf("%s: %d of %d blocks are corrupted", f.Name(), corrupted, len(t.Index))
+	}
+	return nil
+}
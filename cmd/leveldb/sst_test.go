@@ -0,0 +1,92 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/urfave/cli/v2"
+)
+
+// newTestDB creates a database holding a and b in a table file and c in the
+// journal, and returns its path.
+func newTestDB(t *testing.T) string {
+	dbpath := filepath.Join(t.TempDir(), "db")
+	db, err := leveldb.OpenFile(dbpath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range [][2]string{{"a", "1"}, {"b", "2"}} {
+		if err := db.Put([]byte(kv[0]), []byte(kv[1]), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.CompactRange(util.Range{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Put([]byte("c"), []byte("3"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return dbpath
+}
+
+// runCommand runs cmd with args against dbpath and returns its standard
+// output.
+func runCommand(t *testing.T, cmd *cli.Command, dbpath string, args ...string) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+
+	defer func(stdout *os.File, output io.Writer, noColor bool) {
+		os.Stdout, color.Output, color.NoColor = stdout, output, noColor
+	}(os.Stdout, color.Output, color.NoColor)
+	os.Stdout, color.Output, color.NoColor = w, w, true
+
+	app := &cli.App{
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "dbpath"},
+			&cli.BoolFlag{Name: "indexeddb"},
+		},
+		Commands: []*cli.Command{cmd},
+		Writer:   io.Discard,
+	}
+	err = app.Run(append([]string{"leveldb", "--dbpath", dbpath, cmd.Name}, args...))
+	w.Close()
+	return <-done, err
+}
+
+func TestSstCmd(t *testing.T) {
+	dbpath := newTestDB(t)
+	tables, err := filepath.Glob(filepath.Join(dbpath, "*.ldb"))
+	if err != nil || len(tables) != 1 {
+		t.Fatalf("tables = %v, %v", tables, err)
+	}
+
+	got, err := runCommand(t, &cli.Command{Name: "sst", Action: sstCmd}, dbpath, filepath.Base(tables[0]))
+	if err != nil {
+		t.Fatalf("sst: unexpected error: %v", err)
+	}
+	for _, want := range []string{"filter policy: (none)\n", "  \"a\" seq=1 put: 1\n", "  \"b\" seq=2 put: 2\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sst output does not contain %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/urfave/cli/v2"
+)
+
+var statsProperties = []string{
+	"leveldb.stats",
+	"leveldb.sstables",
+	"leveldb.blockpool",
+	"leveldb.cachedblock",
+	"leveldb.openedtables",
+	"leveldb.alivesnaps",
+	"leveldb.aliveiters",
+}
+
+type statsReport struct {
+	Properties map[string]string `json:"properties"`
+	Stats      *leveldb.DBStats  `json:"stats"`
+}
+
+func writeStatsText(w io.Writer, report *statsReport) error {
+	for _, name := range statsProperties {
+		value := strings.TrimRight(report.Properties[name], "\n")
+		if strings.Contains(value, "\n") {
+			value = "\n  " + strings.ReplaceAll(value, "\n", "\n  ")
+		} else if value != "" {
+			value = " " + value
+		}
+		if _, err := fmt.Fprintf(w, "%s:%s\n", name, value); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+	stats := report.Stats
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Level\tTables\tSize\tRead\tWrite\tTime\t")
+	for level := range stats.LevelSizes {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%s\t\n", level,
+			stats.LevelTablesCounts[level], stats.LevelSizes[level],
+			stats.LevelRead[level], stats.LevelWrite[level], stats.LevelDurations[level])
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	counters := []struct {
+		name  string
+		value any
+	}{
+		{"IORead", stats.IORead},
+		{"IOWrite", stats.IOWrite},
+		{"WriteDelayCount", stats.WriteDelayCount},
+		{"WriteDelayDuration", stats.WriteDelayDuration},
+		{"WritePaused", stats.WritePaused},
+		{"AliveSnapshots", stats.AliveSnapshots},
+		{"AliveIterators", stats.AliveIterators},
+		{"BlockCacheSize", stats.BlockCacheSize},
+		{"OpenedTablesCount", stats.OpenedTablesCount},
+		{"MemComp", stats.MemComp},
+		{"Level0Comp", stats.Level0Comp},
+		{"NonLevel0Comp", stats.NonLevel0Comp},
+		{"SeekComp", stats.SeekComp},
+	}
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+	for _, counter := range counters {
+		if _, err := fmt.Fprintf(w, "%s: %v\n", counter.name, counter.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readStats(db *leveldb.DB) (*statsReport, error) {
+	report := &statsReport{
+		Properties: make(map[string]string),
+		Stats:      new(leveldb.DBStats),
+	}
+	for _, name := range statsProperties {
+		value, err := db.GetProperty(name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		report.Properties[name] = value
+	}
+	if err := db.Stats(report.Stats); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func statsCmd(c *cli.Context) error {
+	cmp, err := getComparer(c)
+	if err != nil {
+		return err
+	}
+
+	db, err := leveldb.OpenFile(c.String("dbpath"), &opt.Options{
+		Comparer:       cmp,
+		ErrorIfMissing: true,
+		ReadOnly:       true,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := readStats(db)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Close(); err != nil {
+		return err
+	}
+
+	if c.Bool("json") {
+		if _, err := newPrettyPrinter(os.Stdout).WriteJSON(report); err != nil {
+			return err
+		}
+		_, err := os.Stdout.WriteString("\n")
+		return err
+	}
+	return writeStatsText(os.Stdout, report)
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestStatsCmd(t *testing.T) {
+	dbpath := newTestDB(t)
+	cmd := &cli.Command{
+		Name:   "stats",
+		Flags:  []cli.Flag{&cli.BoolFlag{Name: "json"}},
+		Action: statsCmd,
+	}
+
+	got, err := runCommand(t, cmd, dbpath)
+	if err != nil {
+		t.Fatalf("stats: unexpected error: %v", err)
+	}
+	for _, want := range []string{"\nleveldb.sstables:\n  --- level 0 ---\n", "Level  Tables", "\nIORead: "} {
+		if !strings.Contains(got, want) {
+			t.Errorf("stats output does not contain %q:\n%s", want, got)
+		}
+	}
+
+	got, err = runCommand(t, cmd, dbpath, "--json")
+	if err != nil {
+		t.Fatalf("stats --json: unexpected error: %v", err)
+	}
+	var report struct {
+		Properties map[string]string
+		Stats      map[string]any
+	}
+	if err := json.Unmarshal([]byte(got), &report); err != nil {
+		t.Fatalf("stats --json: invalid JSON: %v\n%s", err, got)
+	}
+	for _, name := range statsProperties {
+		if _, ok := report.Properties[name]; !ok {
+			t.Errorf("stats --json: missing property %s", name)
+		}
+	}
+	if _, ok := report.Stats["LevelSizes"]; !ok {
+		t.Errorf("stats --json: missing LevelSizes in %v", report.Stats)
+	}
+}
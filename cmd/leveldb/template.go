@@ -0,0 +1,151 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/cions/leveldb-cli/indexeddb"
+	"github.com/urfave/cli/v2"
+)
+
+// templateEntry is the data passed to --template for each entry.
+type templateEntry struct {
+	Key         string
+	Value       string
+	KeyBase64   string
+	ValueBase64 string
+	KeyHex      string
+	ValueHex    string
+	ValueJSON   any
+	KeySize     int
+	ValueSize   int
+
+	// IndexedDB key prefix; set only with --indexeddb.
+	DatabaseId    int64
+	ObjectStoreId int64
+	IndexId       int64
+}
+
+func templateBytes(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("expected string, got %T", v)
+	}
+}
+
+var templateFuncs = template.FuncMap{
+	"escape": func(v any) (string, error) {
+		b, err := templateBytes(v)
+		if err != nil {
+			return "", err
+		}
+		return escape(b), nil
+	},
+	"quote": func(v any) (string, error) {
+		b, err := templateBytes(v)
+		if err != nil {
+			return "", err
+		}
+		buf := new(bytes.Buffer)
+		newPrettyPrinter(buf).SetQuoting(true).SetColor(false).Write(b)
+		return buf.String(), nil
+	},
+	"base64": func(v any) (string, error) {
+		b, err := templateBytes(v)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	},
+	"hex": func(v any) (string, error) {
+		b, err := templateBytes(v)
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(b), nil
+	},
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+type templateWriter struct {
+	w         io.Writer
+	tmpl      *template.Template
+	parseJSON bool
+	indexedDB bool
+}
+
+// newTemplateWriter returns a templateWriter if --template is given, or nil
+// otherwise.
+func newTemplateWriter(c *cli.Context, w io.Writer) (*templateWriter, error) {
+	if !c.IsSet("template") {
+		return nil, nil
+	}
+	tmpl, err := template.New("entry").Funcs(templateFuncs).Parse(c.String("template"))
+	if err != nil {
+		return nil, fmt.Errorf("option --template: %w", err)
+	}
+	return &templateWriter{
+		w:         w,
+		tmpl:      tmpl,
+		parseJSON: !c.Bool("no-json"),
+		indexedDB: c.Bool("indexeddb"),
+	}, nil
+}
+
+func (w *templateWriter) valueJSON(key, value []byte) any {
+	if w.indexedDB {
+		if obj, err := decodeIndexedDBValue(key, value); err == nil {
+			return obj
+		}
+	}
+	if _, obj, ok := parseJSONValue(value); ok {
+		return obj
+	}
+	return nil
+}
+
+func (w *templateWriter) WriteEntry(key, value []byte) error {
+	entry := &templateEntry{
+		Key:         string(key),
+		Value:       string(value),
+		KeyBase64:   base64.StdEncoding.EncodeToString(key),
+		ValueBase64: base64.StdEncoding.EncodeToString(value),
+		KeyHex:      hex.EncodeToString(key),
+		ValueHex:    hex.EncodeToString(value),
+		KeySize:     len(key),
+		ValueSize:   len(value),
+	}
+	if w.indexedDB {
+		if k, err := indexeddb.ParseKey(key); err == nil {
+			entry.DatabaseId = k.DatabaseId
+			entry.ObjectStoreId = k.ObjectStoreId
+			entry.IndexId = k.IndexId
+		}
+	}
+	if w.parseJSON {
+		entry.ValueJSON = w.valueJSON(key, value)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := w.tmpl.Execute(buf, entry); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(w.w)
+	return err
+}
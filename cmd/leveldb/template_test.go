@@ -0,0 +1,40 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+	"text/template"
+)
+
+func TestTemplateWriter(t *testing.T) {
+	cases := []struct {
+		text  string
+		key   string
+		value string
+		want  string
+	}{
+		{`{{.Key}}={{.Value}}`, "k", "v", "k=v\n"},
+		{`{{.KeyBase64}} {{.ValueHex}} {{.KeySize}} {{.ValueSize}}`, "k", "\x00\xff", "aw== 00ff 1 2\n"},
+		{`{{escape .Value}} {{quote .Key}}`, "k\"", "\x00\n", "\\0\\n \"k\\\"\"\n"},
+		{`{{base64 .Value}} {{hex .Key}}`, "k", "v", "dg== 6b\n"},
+		{`{{.ValueJSON.a}} {{json .ValueJSON}}`, "k", `{"a":[1,"x"]}`, "[1 x] {\"a\":[1,\"x\"]}\n"},
+	}
+
+	for _, tc := range cases {
+		buf := new(bytes.Buffer)
+		w := &templateWriter{
+			w:         buf,
+			tmpl:      template.Must(template.New("entry").Funcs(templateFuncs).Parse(tc.text)),
+			parseJSON: true,
+		}
+		if err := w.WriteEntry([]byte(tc.key), []byte(tc.value)); err != nil {
+			t.Fatalf("WriteEntry(%q): unexpected error: %v", tc.text, err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("WriteEntry(%q) = %q, want %q", tc.text, got, tc.want)
+		}
+	}
+}
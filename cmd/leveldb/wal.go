@@ -0,0 +1,146 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cions/leveldb-cli/dbfile"
+	"github.com/syndtr/goleveldb/leveldb/journal"
+	"github.com/urfave/cli/v2"
+)
+
+type journalDropper struct {
+	w       io.Writer
+	pending []error
+	dropped int
+}
+
+func (d *journalDropper) Drop(err error) {
+	d.pending = append(d.pending, err)
+	d.dropped++
+}
+
+func (d *journalDropper) Flush() error {
+	for _, err := range d.pending {
+		if _, err := fmt.Fprintf(d.w, "dropped: %v\n", err); err != nil {
+			return err
+		}
+	}
+	d.pending = d.pending[:0]
+	return nil
+}
+
+// readJournal calls fn with the payload of every record in the journal file
+// and returns the number of dropped chunks. Corrupted chunks are reported to w
+// and skipped.
+func readJournal(f io.Reader, w io.Writer, fn func(i int, data []byte) error) (int, error) {
+	dropper := &journalDropper{w: w}
+	r := journal.NewReader(bufio.NewReader(f), dropper, false, true)
+	for i := 0; ; i++ {
+		jr, err := r.Next()
+		if err := dropper.Flush(); err != nil {
+			return dropper.dropped, err
+		}
+		if errors.Is(err, io.EOF) {
+			return dropper.dropped, nil
+		} else if err != nil {
+			return dropper.dropped, err
+		}
+
+		data, err := io.ReadAll(jr)
+		if err := dropper.Flush(); err != nil {
+			return dropper.dropped, err
+		}
+		if err != nil {
+			if _, err := fmt.Fprintf(w, "record #%d: error: %v\n", i, err); err != nil {
+				return dropper.dropped, err
+			}
+			continue
+		}
+
+		if err := fn(i, data); err != nil {
+			return dropper.dropped, err
+		}
+	}
+}
+
+func printBatch(rw *recordWriter, i int, data []byte) (bool, error) {
+	batch, err := dbfile.DecodeBatch(data)
+	if batch == nil {
+		_, err := fmt.Printf("record #%d: error: %v\n", i, err)
+		return false, err
+	}
+
+	if _, err := fmt.Printf("batch #%d: seq=%d count=%d\n", i, batch.Seq, batch.Count); err != nil {
+		return false, err
+	}
+	for _, record := range batch.Records {
+		if _, err := fmt.Printf("  seq=%d %v ", record.Seq, record.Kind); err != nil {
+			return false, err
+		}
+		if err := rw.WriteKey(record.Key); err != nil {
+			return false, err
+		}
+		if record.Kind == dbfile.KindPut {
+			if _, err := os.Stdout.WriteString(rw.Separator()); err != nil {
+				return false, err
+			}
+			if err := rw.WriteValue(record.Key, record.Value); err != nil {
+				return false, err
+			}
+		}
+		if _, err := os.Stdout.WriteString("\n"); err != nil {
+			return false, err
+		}
+	}
+	if err != nil {
+		if _, err := fmt.Printf("  error: %v\n", err); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+func walCmd(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return usageError(c)
+	}
+
+	f, err := os.Open(resolveDBFile(c, c.Args().First()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rw, err := newRecordWriter(c)
+	if err != nil {
+		return err
+	}
+	invalid := 0
+	corrupted, err := readJournal(f, os.Stdout, func(i int, data []byte) error {
+		ok, err := printBatch(rw, i, data)
+		if !ok {
+			invalid++
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if corrupted+invalid > 0 {
+		return fmt.Errorf("%s: %d corrupted chunks, %d invalid batches", f.Name(), corrupted, invalid)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestWalCmd(t *testing.T) {
+	dbpath := newTestDB(t)
+	journals, err := filepath.Glob(filepath.Join(dbpath, "*.log"))
+	if err != nil || len(journals) != 1 {
+		t.Fatalf("journals = %v, %v", journals, err)
+	}
+
+	got, err := runCommand(t, &cli.Command{Name: "wal", Action: walCmd}, dbpath, filepath.Base(journals[0]))
+	if err != nil {
+		t.Fatalf("wal: unexpected error: %v", err)
+	}
+	if want := "batch #0: seq=3 count=1\n  seq=3 put \"c\": 3\n"; !strings.Contains(got, want) {
+		t.Errorf("wal output does not contain %q:\n%s", want, got)
+	}
+}
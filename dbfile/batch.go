@@ -0,0 +1,73 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package dbfile
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const batchHeaderLength = 12
+
+// Record is a single operation in a batch.
+type Record struct {
+	Seq   uint64
+	Kind  Kind
+	Key   []byte
+	Value []byte
+}
+
+// Batch is a write batch as stored in journal (.log) files.
+type Batch struct {
+	Seq     uint64
+	Count   int
+	Records []Record
+}
+
+func decodeLengthPrefixed(b []byte) ([]byte, []byte, bool) {
+	length, n := binary.Uvarint(b)
+	if n <= 0 || length > uint64(len(b)-n) {
+		return nil, nil, false
+	}
+	b = b[n:]
+	return b[length:], b[:length:length], true
+}
+
+// DecodeBatch decodes a journal record into a batch. If the record is
+// truncated or malformed, the records decoded so far are returned along with
+// an error.
+func DecodeBatch(b []byte) (*Batch, error) {
+	if len(b) < batchHeaderLength {
+		return nil, fmt.Errorf("batch header too short: %w", ErrCorrupted)
+	}
+	batch := &Batch{
+		Seq:   binary.LittleEndian.Uint64(b),
+		Count: int(binary.LittleEndian.Uint32(b[8:])),
+	}
+	b = b[batchHeaderLength:]
+
+	for i := 0; len(b) > 0; i++ {
+		record := Record{Seq: batch.Seq + uint64(i), Kind: Kind(b[0])}
+		var ok bool
+		switch record.Kind {
+		case KindPut:
+			if b, record.Key, ok = decodeLengthPrefixed(b[1:]); ok {
+				b, record.Value, ok = decodeLengthPrefixed(b)
+			}
+		case KindDelete:
+			b, record.Key, ok = decodeLengthPrefixed(b[1:])
+		default:
+			return batch, fmt.Errorf("invalid record kind %d at index %d: %w", byte(record.Kind), i, ErrCorrupted)
+		}
+		if !ok {
+			return batch, fmt.Errorf("truncated record at index %d: %w", i, ErrCorrupted)
+		}
+		batch.Records = append(batch.Records, record)
+	}
+
+	if len(batch.Records) != batch.Count {
+		return batch, fmt.Errorf("batch has %d records, header says %d: %w", len(batch.Records), batch.Count, ErrCorrupted)
+	}
+	return batch, nil
+}
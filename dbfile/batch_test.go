@@ -0,0 +1,50 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package dbfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestDecodeBatch(t *testing.T) {
+	b := new(leveldb.Batch)
+	b.Put([]byte("k1"), []byte("v1"))
+	b.Delete([]byte("k2"))
+	b.Put([]byte("k3"), nil)
+
+	data := make([]byte, batchHeaderLength)
+	binary.LittleEndian.PutUint64(data, 100)
+	binary.LittleEndian.PutUint32(data[8:], uint32(b.Len()))
+	data = append(data, b.Dump()...)
+
+	batch, err := DecodeBatch(data)
+	if err != nil {
+		t.Fatalf("DecodeBatch: unexpected error: %v", err)
+	}
+	want := []Record{
+		{Seq: 100, Kind: KindPut, Key: []byte("k1"), Value: []byte("v1")},
+		{Seq: 101, Kind: KindDelete, Key: []byte("k2")},
+		{Seq: 102, Kind: KindPut, Key: []byte("k3"), Value: []byte{}},
+	}
+	if len(batch.Records) != len(want) {
+		t.Fatalf("DecodeBatch: got %d records, want %d", len(batch.Records), len(want))
+	}
+	for i, r := range batch.Records {
+		if r.Seq != want[i].Seq || r.Kind != want[i].Kind || string(r.Key) != string(want[i].Key) || string(r.Value) != string(want[i].Value) {
+			t.Errorf("record %d = %+v, want %+v", i, r, want[i])
+		}
+	}
+
+	batch, err = DecodeBatch(data[:len(data)-3])
+	if !errors.Is(err, ErrCorrupted) {
+		t.Errorf("DecodeBatch(truncated): got error %v, want ErrCorrupted", err)
+	}
+	if batch == nil || len(batch.Records) != 2 {
+		t.Errorf("DecodeBatch(truncated): want 2 records decoded before the error")
+	}
+}
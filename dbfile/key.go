@@ -0,0 +1,61 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package dbfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrCorrupted is returned when a file is not in the expected format.
+var ErrCorrupted = errors.New("corrupted")
+
+// Kind is the type of a record.
+type Kind byte
+
+const (
+	KindDelete Kind = 0
+	KindPut    Kind = 1
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindDelete:
+		return "delete"
+	case KindPut:
+		return "put"
+	default:
+		return fmt.Sprintf("kind(%d)", byte(k))
+	}
+}
+
+// InternalKey is a user key tagged with a sequence number and a kind.
+type InternalKey struct {
+	UserKey []byte
+	Seq     uint64
+	Kind    Kind
+}
+
+// ParseInternalKey decodes an internal key as stored in table files.
+func ParseInternalKey(b []byte) (*InternalKey, error) {
+	if len(b) < 8 {
+		return nil, fmt.Errorf("internal key too short: %w", ErrCorrupted)
+	}
+	n := len(b) - 8
+	tag := binary.LittleEndian.Uint64(b[n:])
+	kind := Kind(tag & 0xff)
+	if kind > KindPut {
+		return nil, fmt.Errorf("invalid key kind %d: %w", byte(kind), ErrCorrupted)
+	}
+	return &InternalKey{UserKey: b[:n:n], Seq: tag >> 8, Kind: kind}, nil
+}
+
+// Encode returns the encoded form of the internal key.
+func (k *InternalKey) Encode() []byte {
+	b := make([]byte, len(k.UserKey)+8)
+	copy(b, k.UserKey)
+	binary.LittleEndian.PutUint64(b[len(k.UserKey):], k.Seq<<8|uint64(k.Kind))
+	return b
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package dbfile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+)
+
+// NumLevels is the number of levels in a LevelDB database.
+const NumLevels = 7
+
+const (
+	tagComparer       = 1
+	tagLogNumber      = 2
+	tagNextFileNumber = 3
+	tagLastSequence   = 4
+	tagCompactPointer = 5
+	tagDeletedFile    = 6
+	tagNewFile        = 7
+	tagPrevLogNumber  = 9
+)
+
+// CompactPointer is the key at which the next compaction of a level starts.
+type CompactPointer struct {
+	Level int
+	Key   []byte
+}
+
+// DeletedFile is a table file removed from a level.
+type DeletedFile struct {
+	Level  int
+	Number uint64
+}
+
+// FileMeta describes a table file added to a level.
+type FileMeta struct {
+	Level    int
+	Number   uint64
+	Size     uint64
+	Smallest []byte
+	Largest  []byte
+}
+
+// VersionEdit is a record in a MANIFEST file. Fields that are not present in
+// the record are nil.
+type VersionEdit struct {
+	Comparer        *string
+	LogNumber       *uint64
+	PrevLogNumber   *uint64
+	NextFileNumber  *uint64
+	LastSequence    *uint64
+	CompactPointers []CompactPointer
+	DeletedFiles    []DeletedFile
+	NewFiles        []FileMeta
+}
+
+type editDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *editDecoder) uvarint(field string) uint64 {
+	if d.err != nil {
+		return 0
+	}
+	x, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = fmt.Errorf("bad %s: %w", field, ErrCorrupted)
+		return 0
+	}
+	d.b = d.b[n:]
+	return x
+}
+
+func (d *editDecoder) level(field string) int {
+	level := d.uvarint(field)
+	if d.err == nil && level >= NumLevels {
+		d.err = fmt.Errorf("bad %s %d: %w", field, level, ErrCorrupted)
+	}
+	return int(level)
+}
+
+func (d *editDecoder) bytes(field string) []byte {
+	length := d.uvarint(field)
+	if d.err != nil {
+		return nil
+	}
+	if length > uint64(len(d.b)) {
+		d.err = fmt.Errorf("bad %s: %w", field, ErrCorrupted)
+		return nil
+	}
+	b := d.b[:length:length]
+	d.b = d.b[length:]
+	return b
+}
+
+// DecodeVersionEdit decodes a MANIFEST record.
+func DecodeVersionEdit(b []byte) (*VersionEdit, error) {
+	edit := new(VersionEdit)
+	d := &editDecoder{b: b}
+	for len(d.b) > 0 && d.err == nil {
+		switch tag := d.uvarint("tag"); tag {
+		case tagComparer:
+			name := string(d.bytes("comparer"))
+			edit.Comparer = &name
+		case tagLogNumber:
+			n := d.uvarint("log number")
+			edit.LogNumber = &n
+		case tagPrevLogNumber:
+			n := d.uvarint("previous log number")
+			edit.PrevLogNumber = &n
+		case tagNextFileNumber:
+			n := d.uvarint("next file number")
+			edit.NextFileNumber = &n
+		case tagLastSequence:
+			n := d.uvarint("last sequence")
+			edit.LastSequence = &n
+		case tagCompactPointer:
+			cp := CompactPointer{Level: d.level("compact pointer level")}
+			cp.Key = d.bytes("compact pointer key")
+			edit.CompactPointers = append(edit.CompactPointers, cp)
+		case tagDeletedFile:
+			f := DeletedFile{Level: d.level("deleted file level")}
+			f.Number = d.uvarint("deleted file number")
+			edit.DeletedFiles = append(edit.DeletedFiles, f)
+		case tagNewFile:
+			f := FileMeta{Level: d.level("new file level")}
+			f.Number = d.uvarint("new file number")
+			f.Size = d.uvarint("new file size")
+			f.Smallest = d.bytes("new file smallest key")
+			f.Largest = d.bytes("new file largest key")
+			edit.NewFiles = append(edit.NewFiles, f)
+		default:
+			if d.err == nil {
+				d.err = fmt.Errorf("unknown tag %d: %w", tag, ErrCorrupted)
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return edit, nil
+}
+
+// Version is the state of a database obtained by applying version edits.
+type Version struct {
+	Comparer        string
+	LogNumber       uint64
+	PrevLogNumber   uint64
+	NextFileNumber  uint64
+	LastSequence    uint64
+	CompactPointers [NumLevels][]byte
+	Levels          [NumLevels][]FileMeta
+}
+
+// Apply applies a version edit to v. A file added more than once to the
+// same level is recorded only once.
+func (v *Version) Apply(edit *VersionEdit) {
+	if edit.Comparer != nil {
+		v.Comparer = *edit.Comparer
+	}
+	if edit.LogNumber != nil {
+		v.LogNumber = *edit.LogNumber
+	}
+	if edit.PrevLogNumber != nil {
+		v.PrevLogNumber = *edit.PrevLogNumber
+	}
+	if edit.NextFileNumber != nil {
+		v.NextFileNumber = *edit.NextFileNumber
+	}
+	if edit.LastSequence != nil {
+		v.LastSequence = *edit.LastSequence
+	}
+	for _, cp := range edit.CompactPointers {
+		v.CompactPointers[cp.Level] = cp.Key
+	}
+	for _, f := range edit.DeletedFiles {
+		v.Levels[f.Level] = slices.DeleteFunc(v.Levels[f.Level], func(g FileMeta) bool {
+			return g.Number == f.Number
+		})
+	}
+	for _, f := range edit.NewFiles {
+		v.Levels[f.Level] = slices.DeleteFunc(v.Levels[f.Level], func(g FileMeta) bool {
+			return g.Number == f.Number
+		})
+		v.Levels[f.Level] = append(v.Levels[f.Level], f)
+	}
+}
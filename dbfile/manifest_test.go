@@ -0,0 +1,76 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package dbfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func appendBytes(b, s []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func TestDecodeVersionEdit(t *testing.T) {
+	smallest := (&InternalKey{UserKey: []byte("a"), Seq: 1, Kind: KindPut}).Encode()
+	largest := (&InternalKey{UserKey: []byte("z"), Seq: 2, Kind: KindDelete}).Encode()
+
+	var b []byte
+	b = binary.AppendUvarint(b, tagComparer)
+	b = appendBytes(b, []byte("leveldb.BytewiseComparator"))
+	b = binary.AppendUvarint(b, tagLogNumber)
+	b = binary.AppendUvarint(b, 3)
+	b = binary.AppendUvarint(b, tagNextFileNumber)
+	b = binary.AppendUvarint(b, 6)
+	b = binary.AppendUvarint(b, tagLastSequence)
+	b = binary.AppendUvarint(b, 2)
+	b = binary.AppendUvarint(b, tagNewFile)
+	b = binary.AppendUvarint(b, 1)
+	b = binary.AppendUvarint(b, 5)
+	b = binary.AppendUvarint(b, 1234)
+	b = appendBytes(b, smallest)
+	b = appendBytes(b, largest)
+
+	edit, err := DecodeVersionEdit(b)
+	if err != nil {
+		t.Fatalf("DecodeVersionEdit: unexpected error: %v", err)
+	}
+	if edit.Comparer == nil || *edit.Comparer != "leveldb.BytewiseComparator" {
+		t.Errorf("Comparer = %v, want leveldb.BytewiseComparator", edit.Comparer)
+	}
+	if edit.PrevLogNumber != nil {
+		t.Errorf("PrevLogNumber = %v, want nil", *edit.PrevLogNumber)
+	}
+
+	var v Version
+	v.Apply(edit)
+	if v.LogNumber != 3 || v.NextFileNumber != 6 || v.LastSequence != 2 {
+		t.Errorf("Version = %+v", v)
+	}
+	if len(v.Levels[1]) != 1 || v.Levels[1][0].Number != 5 || v.Levels[1][0].Size != 1234 {
+		t.Fatalf("Levels[1] = %+v", v.Levels[1])
+	}
+	if string(v.Levels[1][0].Largest) != string(largest) {
+		t.Errorf("Largest = %q, want %q", v.Levels[1][0].Largest, largest)
+	}
+
+	var del []byte
+	del = binary.AppendUvarint(del, tagDeletedFile)
+	del = binary.AppendUvarint(del, 1)
+	del = binary.AppendUvarint(del, 5)
+	edit, err = DecodeVersionEdit(del)
+	if err != nil {
+		t.Fatalf("DecodeVersionEdit: unexpected error: %v", err)
+	}
+	v.Apply(edit)
+	if len(v.Levels[1]) != 0 {
+		t.Errorf("Levels[1] = %+v, want empty", v.Levels[1])
+	}
+
+	if _, err := DecodeVersionEdit(b[:len(b)-1]); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("DecodeVersionEdit(truncated): got error %v, want ErrCorrupted", err)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package dbfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+const (
+	footerLength       = 48
+	blockTrailerLength = 5
+	tableMagic         = "\x57\xfb\x80\x8b\x24\x75\x47\xdb"
+	filterPrefix       = "filter."
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func unmaskCRC(c uint32) uint32 {
+	rot := c - 0xa282ead8
+	return rot>>17 | rot<<15
+}
+
+// Compression is the compression type of a block.
+type Compression byte
+
+const (
+	NoCompression     Compression = 0
+	SnappyCompression Compression = 1
+)
+
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "none"
+	case SnappyCompression:
+		return "snappy"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
+// Handle is a pointer to a block in a table file.
+type Handle struct {
+	Offset uint64 `json:"offset"`
+	Length uint64 `json:"length"`
+}
+
+func decodeHandle(b []byte) (Handle, int) {
+	offset, n := binary.Uvarint(b)
+	if n <= 0 {
+		return Handle{}, 0
+	}
+	length, m := binary.Uvarint(b[n:])
+	if m <= 0 {
+		return Handle{}, 0
+	}
+	return Handle{Offset: offset, Length: length}, n + m
+}
+
+// Footer is the fixed-size trailer of a table file.
+type Footer struct {
+	MetaIndex Handle `json:"metaIndex"`
+	Index     Handle `json:"index"`
+}
+
+// BlockEntry is a key/value pair stored in a block.
+type BlockEntry struct {
+	Key   []byte
+	Value []byte
+}
+
+// Block is a decoded block of a table file.
+type Block struct {
+	Handle      Handle
+	Compression Compression
+	Entries     []BlockEntry
+	Restarts    int
+}
+
+// BlockHandleEntry is an entry of the index or metaindex block.
+type BlockHandleEntry struct {
+	Key    []byte
+	Handle Handle
+}
+
+// Table is an open table (.ldb or .sst) file.
+type Table struct {
+	r         io.ReaderAt
+	size      int64
+	Footer    Footer
+	MetaIndex []BlockHandleEntry
+	Index     []BlockHandleEntry
+
+	// IndexCompression is the compression type of the index block.
+	IndexCompression Compression
+}
+
+// OpenTable reads the footer, the metaindex block and the index block of a
+// table file.
+func OpenTable(r io.ReaderAt, size int64) (*Table, error) {
+	if size < footerLength {
+		return nil, fmt.Errorf("file too short to be a table: %w", ErrCorrupted)
+	}
+	footer := make([]byte, footerLength)
+	if _, err := r.ReadAt(footer, size-footerLength); err != nil {
+		return nil, err
+	}
+	if string(footer[footerLength-len(tableMagic):]) != tableMagic {
+		return nil, fmt.Errorf("bad table magic number: %w", ErrCorrupted)
+	}
+
+	t := &Table{r: r, size: size}
+	metaIndex, n := decodeHandle(footer)
+	if n == 0 {
+		return nil, fmt.Errorf("bad metaindex block handle: %w", ErrCorrupted)
+	}
+	index, m := decodeHandle(footer[n:])
+	if m == 0 {
+		return nil, fmt.Errorf("bad index block handle: %w", ErrCorrupted)
+	}
+	t.Footer = Footer{MetaIndex: metaIndex, Index: index}
+
+	block, err := t.ReadBlock(metaIndex)
+	if err != nil {
+		return nil, fmt.Errorf("metaindex block: %w", err)
+	}
+	if t.MetaIndex, err = decodeHandleEntries(block); err != nil {
+		return nil, fmt.Errorf("metaindex block: %w", err)
+	}
+
+	block, err = t.ReadBlock(index)
+	if err != nil {
+		return nil, fmt.Errorf("index block: %w", err)
+	}
+	if t.Index, err = decodeHandleEntries(block); err != nil {
+		return nil, fmt.Errorf("index block: %w", err)
+	}
+	t.IndexCompression = block.Compression
+
+	return t, nil
+}
+
+func decodeHandleEntries(block *Block) ([]BlockHandleEntry, error) {
+	entries := make([]BlockHandleEntry, 0, len(block.Entries))
+	for _, entry := range block.Entries {
+		handle, n := decodeHandle(entry.Value)
+		if n == 0 {
+			return nil, fmt.Errorf("bad block handle: %w", ErrCorrupted)
+		}
+		entries = append(entries, BlockHandleEntry{Key: entry.Key, Handle: handle})
+	}
+	return entries, nil
+}
+
+// FilterPolicy returns the name of the filter policy used by the table, or
+// an empty string if the table has no filter block.
+func (t *Table) FilterPolicy() string {
+	for _, entry := range t.MetaIndex {
+		if name, ok := bytes.CutPrefix(entry.Key, []byte(filterPrefix)); ok {
+			return string(name)
+		}
+	}
+	return ""
+}
+
+// ReadBlock reads, verifies and decodes the block pointed to by h.
+func (t *Table) ReadBlock(h Handle) (*Block, error) {
+	// Compare without adding to h.Length, which may overflow on a corrupt
+	// table.
+	if h.Offset > uint64(t.size) || uint64(t.size)-h.Offset < blockTrailerLength || h.Length > uint64(t.size)-h.Offset-blockTrailerLength {
+		return nil, fmt.Errorf("block handle out of range: %w", ErrCorrupted)
+	}
+	b := make([]byte, h.Length+blockTrailerLength)
+	if _, err := t.r.ReadAt(b, int64(h.Offset)); err != nil {
+		return nil, err
+	}
+
+	data := b[:h.Length+1]
+	checksum := binary.LittleEndian.Uint32(b[h.Length+1:])
+	if crc32.Checksum(data, crcTable) != unmaskCRC(checksum) {
+		return nil, fmt.Errorf("block checksum mismatch: %w", ErrCorrupted)
+	}
+
+	block := &Block{Handle: h, Compression: Compression(b[h.Length])}
+	data = b[:h.Length]
+	switch block.Compression {
+	case NoCompression:
+	case SnappyCompression:
+		decoded, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("snappy: %w", err)
+		}
+		data = decoded
+	default:
+		return nil, fmt.Errorf("unknown compression type %d: %w", byte(block.Compression), ErrCorrupted)
+	}
+
+	entries, restarts, err := decodeBlock(data)
+	if err != nil {
+		return nil, err
+	}
+	block.Entries = entries
+	block.Restarts = restarts
+	return block, nil
+}
+
+func decodeBlock(data []byte) ([]BlockEntry, int, error) {
+	if len(data) < 4 {
+		return nil, 0, fmt.Errorf("block too short: %w", ErrCorrupted)
+	}
+	restarts := int(binary.LittleEndian.Uint32(data[len(data)-4:]))
+	if restarts == 0 || restarts > (len(data)-4)/4 {
+		return nil, 0, fmt.Errorf("bad number of restart points: %w", ErrCorrupted)
+	}
+	data = data[:len(data)-4-4*restarts]
+
+	var entries []BlockEntry
+	var key []byte
+	for len(data) > 0 {
+		var fields [3]uint64
+		for i := range fields {
+			v, n := binary.Uvarint(data)
+			if n <= 0 {
+				return entries, restarts, fmt.Errorf("bad block entry header: %w", ErrCorrupted)
+			}
+			fields[i] = v
+			data = data[n:]
+		}
+		shared, unshared, valueLength := fields[0], fields[1], fields[2]
+		if shared > uint64(len(key)) || unshared+valueLength > uint64(len(data)) {
+			return entries, restarts, fmt.Errorf("bad block entry: %w", ErrCorrupted)
+		}
+		key = append(key[:shared:shared], data[:unshared]...)
+		data = data[unshared:]
+		entries = append(entries, BlockEntry{Key: key, Value: data[:valueLength:valueLength]})
+		data = data[valueLength:]
+	}
+	return entries, restarts, nil
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package dbfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/table"
+)
+
+func writeTable(t *testing.T, o *opt.Options, keys []*InternalKey) []byte {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	w := table.NewWriter(buf, o, nil, 0)
+	for i, key := range keys {
+		if err := w.Append(key.Encode(), []byte(fmt.Sprintf("value%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenTable(t *testing.T) {
+	var keys []*InternalKey
+	for i := 0; i < 100; i++ {
+		keys = append(keys, &InternalKey{UserKey: []byte(fmt.Sprintf("key%03d", i)), Seq: uint64(100 - i), Kind: KindPut})
+	}
+	keys[42].Kind = KindDelete
+
+	for _, compression := range []opt.Compression{opt.NoCompression, opt.SnappyCompression} {
+		data := writeTable(t, &opt.Options{
+			BlockSize:   256,
+			Compression: compression,
+			Filter:      filter.NewBloomFilter(10),
+		}, keys)
+
+		tbl, err := OpenTable(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("OpenTable: unexpected error: %v", err)
+		}
+		if got, want := tbl.FilterPolicy(), "leveldb.BuiltinBloomFilter"; got != want {
+			t.Errorf("FilterPolicy() = %q, want %q", got, want)
+		}
+		if len(tbl.Index) < 2 {
+			t.Errorf("len(Index) = %d, want >= 2", len(tbl.Index))
+		}
+
+		i := 0
+		for _, entry := range tbl.Index {
+			block, err := tbl.ReadBlock(entry.Handle)
+			if err != nil {
+				t.Fatalf("ReadBlock: unexpected error: %v", err)
+			}
+			if compression == opt.SnappyCompression && block.Compression != SnappyCompression {
+				t.Errorf("Compression = %v, want %v", block.Compression, SnappyCompression)
+			}
+			for _, e := range block.Entries {
+				ikey, err := ParseInternalKey(e.Key)
+				if err != nil {
+					t.Fatalf("ParseInternalKey: unexpected error: %v", err)
+				}
+				if !bytes.Equal(ikey.UserKey, keys[i].UserKey) || ikey.Seq != keys[i].Seq || ikey.Kind != keys[i].Kind {
+					t.Errorf("entry %d = %q/%d/%v, want %q/%d/%v", i, ikey.UserKey, ikey.Seq, ikey.Kind, keys[i].UserKey, keys[i].Seq, keys[i].Kind)
+				}
+				if want := fmt.Sprintf("value%d", i); string(e.Value) != want {
+					t.Errorf("value %d = %q, want %q", i, e.Value, want)
+				}
+				i++
+			}
+		}
+		if i != len(keys) {
+			t.Errorf("got %d entries, want %d", i, len(keys))
+		}
+	}
+}
+
+func TestReadBlockChecksum(t *testing.T) {
+	data := writeTable(t, &opt.Options{Compression: opt.NoCompression}, []*InternalKey{
+		{UserKey: []byte("a"), Seq: 1, Kind: KindPut},
+	})
+	data[0] ^= 0xff
+
+	tbl, err := OpenTable(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("OpenTable: unexpected error: %v", err)
+	}
+	if _, err := tbl.ReadBlock(tbl.Index[0].Handle); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("ReadBlock: got error %v, want ErrCorrupted", err)
+	}
+}
+
+func TestReadBlockOutOfRange(t *testing.T) {
+	data := writeTable(t, nil, []*InternalKey{
+		{UserKey: []byte("a"), Seq: 1, Kind: KindPut},
+	})
+
+	tbl, err := OpenTable(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("OpenTable: unexpected error: %v", err)
+	}
+	size := uint64(len(data))
+	for _, h := range []Handle{
+		{Offset: 0, Length: math.MaxUint64},
+		{Offset: 0, Length: math.MaxUint64 - blockTrailerLength + 1},
+		{Offset: 0, Length: size - blockTrailerLength + 1},
+		{Offset: size - blockTrailerLength + 1, Length: 0},
+		{Offset: size + 1, Length: 0},
+	} {
+		if _, err := tbl.ReadBlock(h); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("ReadBlock(%+v): got error %v, want ErrCorrupted", h, err)
+		}
+	}
+}
@@ -4,14 +4,16 @@ go 1.22
 
 require (
 	github.com/fatih/color v1.17.0
+	github.com/golang/snappy v0.0.4
 	github.com/syndtr/goleveldb v1.0.1-0.20220721030215-126854af5e6d
 	github.com/urfave/cli/v2 v2.27.4
 	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/term v0.23.0
+	google.golang.org/protobuf v1.34.2
 )
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.4 // indirect
-	github.com/golang/snappy v0.0.4 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
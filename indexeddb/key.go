@@ -0,0 +1,348 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package indexeddb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// ErrInvalidKey is returned when a key cannot be decoded as an IndexedDB key.
+var ErrInvalidKey = errors.New("invalid IndexedDB key")
+
+// KeyType represents the type of an IndexedDB key.
+type KeyType int
+
+const (
+	GlobalMetaDataKey   KeyType = globalMetadata
+	DatabaseMetaDataKey KeyType = databaseMetadata
+	ObjectStoreDataKey  KeyType = objectStoreData
+	ExistsEntryKey      KeyType = existsEntry
+	IndexDataKey        KeyType = indexData
+	InvalidKey          KeyType = invalidType
+	BlobEntryKey        KeyType = blobEntry
+)
+
+var globalMetaDataNames = []string{
+	"SchemaVersion",
+	"MaxDatabaseId",
+	"DataVersion",
+	"RecoveryBlobJournal",
+	"ActiveBlobJournal",
+	"EarliestSweep",
+	"EarliestCompactionTime",
+}
+
+var databaseMetaDataNames = []string{
+	"OriginName",
+	"DatabaseName",
+	"UserStringVersion",
+	"MaxObjectStoreId",
+	"UserVersion",
+	"BlobKeyGeneratorCurrentNumber",
+}
+
+var objectStoreMetaDataNames = []string{
+	"Name",
+	"KeyPath",
+	"AutoIncrement",
+	"Evictable",
+	"LastVersion",
+	"MaxIndexId",
+	"HasKeyPath",
+	"KeyGeneratorCurrentNumber",
+}
+
+var indexMetaDataNames = []string{
+	"Name",
+	"Unique",
+	"KeyPath",
+	"MultiEntry",
+}
+
+func lookupName(names []string, b byte) string {
+	if int(b) < len(names) {
+		return names[b]
+	}
+	return fmt.Sprintf("Unknown(%d)", b)
+}
+
+// Date represents an IndexedDB date key as milliseconds since the Unix epoch.
+type Date float64
+
+// Time returns the time represented by d.
+func (d Date) Time() time.Time {
+	sec, frac := math.Modf(float64(d) / 1000)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC()
+}
+
+func (d Date) String() string {
+	return d.Time().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d Date) MarshalJSON() ([]byte, error) {
+	return strconv.AppendQuote(nil, d.String()), nil
+}
+
+// Binary represents an IndexedDB binary key.
+type Binary []byte
+
+// MinKey represents the minimum IndexedDB key, which sorts before any other key.
+type MinKey struct{}
+
+// Key represents a decoded key of Chromium's IndexedDB database.
+type Key struct {
+	DatabaseId    int64
+	ObjectStoreId int64
+	IndexId       int64
+
+	// MetaDataType is the type byte of a global or database metadata key.
+	MetaDataType byte
+	// Property is the trailing type byte of an object store or index
+	// metadata key.
+	Property byte
+	// TargetDatabaseId, TargetObjectStoreId and TargetIndexId are the ids
+	// encoded in the body of a metadata key.
+	TargetDatabaseId    int64
+	TargetObjectStoreId int64
+	TargetIndexId       int64
+	// Origin and Name are the strings encoded in the body of a metadata key.
+	Origin, Name string
+	// Scope is the body of a scopes key.
+	Scope []byte
+
+	// UserKey is the primary key of an object store data, exists or blob
+	// entry, or the index key of an index data entry.
+	UserKey any
+	// SequenceNumber and PrimaryKey are set for index data entries.
+	SequenceNumber int64
+	PrimaryKey     any
+}
+
+// Type returns the type of the key.
+func (k *Key) Type() KeyType {
+	prefix := &keyPrefix{k.DatabaseId, k.ObjectStoreId, k.IndexId}
+	return KeyType(prefix.Type())
+}
+
+func (k *Key) String() string {
+	var sb strings.Builder
+
+	switch k.Type() {
+	case GlobalMetaDataKey:
+		switch k.MetaDataType {
+		case scopesPrefixByte:
+			fmt.Fprintf(&sb, "Scopes %s", strconv.Quote(string(k.Scope)))
+		case databaseFreeListTypeByte:
+			fmt.Fprintf(&sb, "DatabaseFreeList db=%d", k.TargetDatabaseId)
+		case databaseNameTypeByte:
+			fmt.Fprintf(&sb, "DatabaseName origin=%s name=%s", strconv.Quote(k.Origin), strconv.Quote(k.Name))
+		default:
+			sb.WriteString(lookupName(globalMetaDataNames, k.MetaDataType))
+		}
+	case DatabaseMetaDataKey:
+		fmt.Fprintf(&sb, "db=%d ", k.DatabaseId)
+		switch k.MetaDataType {
+		case objectStoreMetaDataTypeByte:
+			fmt.Fprintf(&sb, "ObjectStoreMetaData store=%d %s", k.TargetObjectStoreId, lookupName(objectStoreMetaDataNames, k.Property))
+		case indexMetaDataTypeByte:
+			fmt.Fprintf(&sb, "IndexMetaData store=%d index=%d %s", k.TargetObjectStoreId, k.TargetIndexId, lookupName(indexMetaDataNames, k.Property))
+		case objectStoreFreeListTypeByte:
+			fmt.Fprintf(&sb, "ObjectStoreFreeList store=%d", k.TargetObjectStoreId)
+		case indexFreeListTypeByte:
+			fmt.Fprintf(&sb, "IndexFreeList store=%d index=%d", k.TargetObjectStoreId, k.TargetIndexId)
+		case objectStoreNamesTypeByte:
+			fmt.Fprintf(&sb, "ObjectStoreNames name=%s", strconv.Quote(k.Name))
+		case indexNamesKeyTypeByte:
+			fmt.Fprintf(&sb, "IndexNames store=%d name=%s", k.TargetObjectStoreId, strconv.Quote(k.Name))
+		default:
+			sb.WriteString(lookupName(databaseMetaDataNames, k.MetaDataType))
+		}
+	case IndexDataKey:
+		fmt.Fprintf(&sb, "db=%d store=%d index=%d key=%s seq=%d primaryKey=%s", k.DatabaseId, k.ObjectStoreId, k.IndexId, FormatKeyValue(k.UserKey), k.SequenceNumber, FormatKeyValue(k.PrimaryKey))
+	default:
+		fmt.Fprintf(&sb, "db=%d store=%d index=%d key=%s", k.DatabaseId, k.ObjectStoreId, k.IndexId, FormatKeyValue(k.UserKey))
+	}
+
+	return sb.String()
+}
+
+// FormatKeyValue returns a human-readable representation of a decoded
+// IndexedDB key value.
+func FormatKeyValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case Date:
+		return "Date(" + v.String() + ")"
+	case Binary:
+		return "Binary(" + strconv.Quote(string(v)) + ")"
+	case MinKey:
+		return "MinKey"
+	case []any:
+		elems := make([]string, len(v))
+		for i, elem := range v {
+			elems[i] = FormatKeyValue(elem)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func decodeStringWithLength(a []byte) ([]byte, string) {
+	a, v := decodeVarInt(a)
+	length := 2 * uint64(v)
+	if uint64(len(a)) < length {
+		panic("invalid key")
+	}
+	return a[length:], decodeString(a[:length])
+}
+
+func decodeString(a []byte) string {
+	if len(a)%2 != 0 {
+		panic("invalid key")
+	}
+	units := make([]uint16, len(a)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(a[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeBinary(a []byte) ([]byte, []byte) {
+	a, length := decodeVarInt(a)
+	if uint64(len(a)) < uint64(length) {
+		panic("invalid key")
+	}
+	return a[length:], a[:length:length]
+}
+
+func decodeDouble(a []byte) ([]byte, float64) {
+	if len(a) < 8 {
+		panic("invalid key")
+	}
+	return a[8:], math.Float64frombits(binary.NativeEndian.Uint64(a))
+}
+
+func decodeIDBKey(a []byte) ([]byte, any) {
+	if len(a) == 0 {
+		panic("invalid key")
+	}
+
+	typeByte := a[0]
+	a = a[1:]
+
+	switch typeByte {
+	case indexedDBKeyNullTypeByte:
+		return a, nil
+	case indexedDBKeyStringTypeByte:
+		return decodeStringWithLength(a)
+	case indexedDBKeyDateTypeByte:
+		a, v := decodeDouble(a)
+		return a, Date(v)
+	case indexedDBKeyNumberTypeByte:
+		return decodeDouble(a)
+	case indexedDBKeyArrayTypeByte:
+		a, length := decodeVarInt(a)
+		if uint64(length) > uint64(len(a)) {
+			panic("invalid key")
+		}
+		elems := make([]any, length)
+		for i := range elems {
+			a, elems[i] = decodeIDBKey(a)
+		}
+		return a, elems
+	case indexedDBKeyMinKeyTypeByte:
+		return a, MinKey{}
+	case indexedDBKeyBinaryTypeByte:
+		a, v := decodeBinary(a)
+		return a, Binary(v)
+	default:
+		panic("invalid key")
+	}
+}
+
+func decodeKeyBody(a []byte, k *Key) {
+	switch k.Type() {
+	case GlobalMetaDataKey:
+		k.MetaDataType = a[0]
+		a = a[1:]
+
+		switch k.MetaDataType {
+		case scopesPrefixByte:
+			k.Scope = a
+		case databaseFreeListTypeByte:
+			_, k.TargetDatabaseId = decodeVarInt(a)
+		case databaseNameTypeByte:
+			a, k.Origin = decodeStringWithLength(a)
+			_, k.Name = decodeStringWithLength(a)
+		}
+	case DatabaseMetaDataKey:
+		k.MetaDataType = a[0]
+		a = a[1:]
+
+		switch k.MetaDataType {
+		case objectStoreMetaDataTypeByte:
+			a, k.TargetObjectStoreId = decodeVarInt(a)
+			k.Property = a[0]
+		case indexMetaDataTypeByte:
+			a, k.TargetObjectStoreId = decodeVarInt(a)
+			a, k.TargetIndexId = decodeVarInt(a)
+			k.Property = a[0]
+		case objectStoreFreeListTypeByte:
+			_, k.TargetObjectStoreId = decodeVarInt(a)
+		case indexFreeListTypeByte:
+			a, k.TargetObjectStoreId = decodeVarInt(a)
+			_, k.TargetIndexId = decodeVarInt(a)
+		case objectStoreNamesTypeByte:
+			_, k.Name = decodeStringWithLength(a)
+		case indexNamesKeyTypeByte:
+			a, k.TargetObjectStoreId = decodeVarInt(a)
+			_, k.Name = decodeStringWithLength(a)
+		}
+	case ObjectStoreDataKey, ExistsEntryKey, BlobEntryKey:
+		_, k.UserKey = decodeIDBKey(a)
+	case IndexDataKey:
+		a, k.UserKey = decodeIDBKey(a)
+		k.SequenceNumber = -1
+		if len(a) > 0 {
+			a, k.SequenceNumber = decodeVarInt(a)
+		}
+		if len(a) > 0 {
+			_, k.PrimaryKey = decodeIDBKey(a)
+		}
+	default:
+		panic("invalid key")
+	}
+}
+
+// ParseKey decodes a key of Chromium's IndexedDB database.
+func ParseKey(b []byte) (k *Key, err error) {
+	defer func() {
+		if recover() != nil {
+			k, err = nil, ErrInvalidKey
+		}
+	}()
+
+	b, prefix := decodeKeyPrefix(b)
+	k = &Key{
+		DatabaseId:    prefix.DatabaseId,
+		ObjectStoreId: prefix.ObjectStoreId,
+		IndexId:       prefix.IndexId,
+	}
+	decodeKeyBody(b, k)
+	return k, nil
+}
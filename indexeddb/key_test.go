@@ -0,0 +1,59 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package indexeddb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	cases := []struct {
+		Key, Want string
+	}{
+		{"00 00 00 00 00", "SchemaVersion"},
+		{"00 00 00 00 01", "MaxDatabaseId"},
+		{"00 00 00 00 64 05", "DatabaseFreeList db=5"},
+		{"00 00 00 00 c9 01 0061 02 00610062", `DatabaseName origin="a" name="ab"`},
+		{"00 00 00 00 32 6162", `Scopes "ab"`},
+		{"00 01 00 00 00", "db=1 OriginName"},
+		{"00 01 00 00 03", "db=1 MaxObjectStoreId"},
+		{"00 01 00 00 32 03 01", "db=1 ObjectStoreMetaData store=3 KeyPath"},
+		{"00 01 00 00 64 03 1e 03", "db=1 IndexMetaData store=3 index=30 MultiEntry"},
+		{"00 01 00 00 96 03", "db=1 ObjectStoreFreeList store=3"},
+		{"00 01 00 00 97 03 1e", "db=1 IndexFreeList store=3 index=30"},
+		{"00 01 00 00 c8 01 0078", `db=1 ObjectStoreNames name="x"`},
+		{"00 01 00 00 c9 03 01 0078", `db=1 IndexNames store=3 name="x"`},
+		{"00 01 03 01 03 0000000000004540", "db=1 store=3 index=1 key=42"},
+		{"00 01 03 01 04 02 01 03 006100620063 03 0000000000004540", `db=1 store=3 index=1 key=["abc", 42]`},
+		{"00 01 03 01 06 02 0102", `db=1 store=3 index=1 key=Binary("\x01\x02")`},
+		{"00 01 03 01 02 0000000000000000", "db=1 store=3 index=1 key=Date(1970-01-01T00:00:00.000Z)"},
+		{"00 01 03 02 01 01 0078", `db=1 store=3 index=2 key="x"`},
+		{"00 01 03 1e 01 01 0078 00 03 000000000000f03f", `db=1 store=3 index=30 key="x" seq=0 primaryKey=1`},
+	}
+
+	for _, tc := range cases {
+		key, err := ParseKey(decodeHex(tc.Key))
+		if err != nil {
+			t.Errorf("ParseKey(%s): unexpected error: %v", tc.Key, err)
+		} else if got := key.String(); got != tc.Want {
+			t.Errorf("ParseKey(%s) = %s, want %s", tc.Key, got, tc.Want)
+		}
+	}
+
+	invalids := []string{
+		"",
+		"00 00",
+		"00 01 03 01",
+		"00 01 03 01 01 05 0061",
+		"00 01 03 01 04 02 01",
+		"00 01 03 01 09",
+	}
+
+	for _, input := range invalids {
+		if _, err := ParseKey(decodeHex(input)); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ParseKey(%s) should fail with ErrInvalidKey", input)
+		}
+	}
+}
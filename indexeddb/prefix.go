@@ -451,3 +451,17 @@ func Prefix(prefix []byte) *util.Range {
 	}
 	return &util.Range{Start: start, Limit: limit}
 }
+
+// KeyPrefixRange returns the key range of the keys that have the given key prefix.
+func KeyPrefixRange(databaseId, objectStoreId, indexId int64) *util.Range {
+	return Prefix(encodeKeyPrefix(&keyPrefix{
+		DatabaseId:    databaseId,
+		ObjectStoreId: objectStoreId,
+		IndexId:       indexId,
+	}))
+}
+
+// ObjectStoreDataRange returns the key range of the records of the given object store.
+func ObjectStoreDataRange(databaseId, objectStoreId int64) *util.Range {
+	return KeyPrefixRange(databaseId, objectStoreId, objectStoreDataIndexId)
+}
@@ -201,3 +201,21 @@ func TestPrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestObjectStoreDataRange(t *testing.T) {
+	cases := []struct {
+		DatabaseId, ObjectStoreId int64
+		Start, Limit              string
+	}{
+		{1, 1, "00 01 01 01", "00 01 01 02"},
+		{1, 300, "04 01 2c01 01", "04 01 2c01 02"},
+	}
+
+	for _, tc := range cases {
+		got := ObjectStoreDataRange(tc.DatabaseId, tc.ObjectStoreId)
+		want := &util.Range{Start: decodeHex(tc.Start), Limit: decodeHex(tc.Limit)}
+		if !bytes.Equal(got.Start, want.Start) || !bytes.Equal(got.Limit, want.Limit) {
+			t.Errorf("ObjectStoreDataRange(%d, %d) = {%x, %x}, want {%x, %x}", tc.DatabaseId, tc.ObjectStoreId, got.Start, got.Limit, want.Start, want.Limit)
+		}
+	}
+}
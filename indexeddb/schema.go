@@ -0,0 +1,238 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package indexeddb
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	databaseUserVersion = 4
+)
+
+const (
+	objectStoreName                      = 0
+	objectStoreKeyPath                   = 1
+	objectStoreAutoIncrement             = 2
+	objectStoreKeyGeneratorCurrentNumber = 7
+)
+
+const (
+	indexName       = 0
+	indexUnique     = 1
+	indexKeyPath    = 2
+	indexMultiEntry = 3
+)
+
+const (
+	keyPathTypeCodedByte1 = 0
+	keyPathTypeCodedByte2 = 0
+	keyPathNullType       = 0
+	keyPathStringType     = 1
+	keyPathArrayType      = 2
+)
+
+// Database describes the schema of an IndexedDB database.
+type Database struct {
+	Id           int64          `json:"id"`
+	Origin       string         `json:"origin"`
+	Name         string         `json:"name"`
+	Version      int64          `json:"version"`
+	ObjectStores []*ObjectStore `json:"objectStores"`
+}
+
+// ObjectStore describes the schema of an IndexedDB object store.
+type ObjectStore struct {
+	Id            int64    `json:"id"`
+	Name          string   `json:"name"`
+	KeyPath       any      `json:"keyPath"`
+	AutoIncrement bool     `json:"autoIncrement"`
+	KeyGenerator  int64    `json:"keyGenerator"`
+	Indexes       []*Index `json:"indexes"`
+}
+
+// Index describes the schema of an IndexedDB index.
+type Index struct {
+	Id         int64  `json:"id"`
+	Name       string `json:"name"`
+	KeyPath    any    `json:"keyPath"`
+	Unique     bool   `json:"unique"`
+	MultiEntry bool   `json:"multiEntry"`
+}
+
+// ObjectStore returns the object store with the given name, or nil if not found.
+func (db *Database) ObjectStore(name string) *ObjectStore {
+	for _, store := range db.ObjectStores {
+		if store.Name == name {
+			return store
+		}
+	}
+	return nil
+}
+
+func (db *Database) objectStore(id int64) *ObjectStore {
+	for _, store := range db.ObjectStores {
+		if store.Id == id {
+			return store
+		}
+	}
+	store := &ObjectStore{Id: id, Indexes: []*Index{}}
+	db.ObjectStores = append(db.ObjectStores, store)
+	return store
+}
+
+func (store *ObjectStore) index(id int64) *Index {
+	for _, index := range store.Indexes {
+		if index.Id == id {
+			return index
+		}
+	}
+	index := &Index{Id: id}
+	store.Indexes = append(store.Indexes, index)
+	return index
+}
+
+func decodeBool(a []byte) bool {
+	if len(a) == 0 {
+		panic("invalid value")
+	}
+	return a[0] != 0
+}
+
+func decodeKeyPath(a []byte) any {
+	if len(a) < 3 || a[0] != keyPathTypeCodedByte1 || a[1] != keyPathTypeCodedByte2 {
+		return decodeString(a)
+	}
+
+	typeByte := a[2]
+	a = a[3:]
+
+	switch typeByte {
+	case keyPathNullType:
+		return nil
+	case keyPathStringType:
+		_, s := decodeStringWithLength(a)
+		return s
+	case keyPathArrayType:
+		a, length := decodeVarInt(a)
+		if uint64(length) > uint64(len(a)) {
+			panic("invalid value")
+		}
+		paths := make([]string, length)
+		for i := range paths {
+			a, paths[i] = decodeStringWithLength(a)
+		}
+		return paths
+	default:
+		panic("invalid value")
+	}
+}
+
+func applyMetaData(db *Database, k *Key, value []byte) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = fmt.Errorf("invalid metadata value for %v", k)
+		}
+	}()
+
+	switch k.MetaDataType {
+	case databaseUserVersion:
+		_, db.Version = decodeVarInt(value)
+	case objectStoreMetaDataTypeByte:
+		store := db.objectStore(k.TargetObjectStoreId)
+		switch k.Property {
+		case objectStoreName:
+			store.Name = decodeString(value)
+		case objectStoreKeyPath:
+			store.KeyPath = decodeKeyPath(value)
+		case objectStoreAutoIncrement:
+			store.AutoIncrement = decodeBool(value)
+		case objectStoreKeyGeneratorCurrentNumber:
+			store.KeyGenerator = decodeInt(value)
+		}
+	case indexMetaDataTypeByte:
+		index := db.objectStore(k.TargetObjectStoreId).index(k.TargetIndexId)
+		switch k.Property {
+		case indexName:
+			index.Name = decodeString(value)
+		case indexUnique:
+			index.Unique = decodeBool(value)
+		case indexKeyPath:
+			index.KeyPath = decodeKeyPath(value)
+		case indexMultiEntry:
+			index.MultiEntry = decodeBool(value)
+		}
+	}
+	return nil
+}
+
+func readDatabase(r leveldb.Reader, db *Database) error {
+	iter := r.NewIterator(Prefix(encodeKeyPrefix(&keyPrefix{DatabaseId: db.Id})), nil)
+	defer iter.Release()
+	for iter.Next() {
+		k, err := ParseKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		if err := applyMetaData(db, k, iter.Value()); err != nil {
+			return err
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	slices.SortFunc(db.ObjectStores, func(a, b *ObjectStore) int {
+		return cmp.Compare(a.Id, b.Id)
+	})
+	for _, store := range db.ObjectStores {
+		slices.SortFunc(store.Indexes, func(a, b *Index) int {
+			return cmp.Compare(a.Id, b.Id)
+		})
+	}
+	return nil
+}
+
+// ReadSchema reads the metadata of all databases stored in an IndexedDB database.
+func ReadSchema(r leveldb.Reader) ([]*Database, error) {
+	var dbs []*Database
+	prefix := append(encodeKeyPrefix(&keyPrefix{}), databaseNameTypeByte)
+
+	iter := r.NewIterator(Prefix(prefix), nil)
+	defer iter.Release()
+	for iter.Next() {
+		k, err := ParseKey(iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		if len(iter.Value()) == 0 || len(iter.Value()) > 8 {
+			return nil, fmt.Errorf("invalid metadata value for %v", k)
+		}
+		id := decodeInt(iter.Value())
+		if id <= 0 {
+			return nil, fmt.Errorf("invalid database id for %v", k)
+		}
+		dbs = append(dbs, &Database{
+			Id:           id,
+			Origin:       k.Origin,
+			Name:         k.Name,
+			ObjectStores: []*ObjectStore{},
+		})
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	iter.Release()
+
+	for _, db := range dbs {
+		if err := readDatabase(r, db); err != nil {
+			return nil, err
+		}
+	}
+	return dbs, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package indexeddb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+func openMemDB(t *testing.T, entries [][2]string) *leveldb.DB {
+	t.Helper()
+
+	db, err := leveldb.Open(storage.NewMemStorage(), &opt.Options{Comparer: Comparer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, entry := range entries {
+		if err := db.Put(decodeHex(entry[0]), decodeHex(entry[1]), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestReadSchema(t *testing.T) {
+	db := openMemDB(t, [][2]string{
+		{"00 00 00 00 c9 01 0061 04 0063006800610074", "01"},
+		{"00 01 00 00 04", "03"},
+		{"00 01 00 00 32 01 00", "006d007300670073"},
+		{"00 01 00 00 32 01 01", "0000 01 02 00690064"},
+		{"00 01 00 00 32 01 02", "01"},
+		{"00 01 00 00 32 01 07", "2a"},
+		{"00 01 00 00 64 01 1e 00", "0064006100740065"},
+		{"00 01 00 00 64 01 1e 01", "00"},
+		{"00 01 00 00 64 01 1e 02", "0000 02 02 01 0061 01 0062"},
+		{"00 01 00 00 64 01 1e 03", "01"},
+		{"00 01 01 01 03 000000000000f03f", "00"},
+	})
+
+	dbs, err := ReadSchema(db)
+	if err != nil {
+		t.Fatalf("ReadSchema: unexpected error: %v", err)
+	}
+
+	got, err := json.Marshal(dbs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"id":1,"origin":"a","name":"chat","version":3,"objectStores":[` +
+		`{"id":1,"name":"msgs","keyPath":"id","autoIncrement":true,"keyGenerator":42,"indexes":[` +
+		`{"id":30,"name":"date","keyPath":["a","b"],"unique":false,"multiEntry":true}]}]}]`
+	if string(got) != want {
+		t.Errorf("ReadSchema() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,794 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package indexeddb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"unicode/utf16"
+)
+
+// References:
+//   https://source.chromium.org/chromium/chromium/src/+/main:v8/src/objects/value-serializer.cc
+//   https://source.chromium.org/chromium/chromium/src/+/main:third_party/blink/renderer/bindings/core/v8/serialization/serialization_tag.h
+
+const (
+	v8VersionTag              = 0xff
+	v8PaddingTag              = 0x00
+	v8VerifyObjectCountTag    = '?'
+	v8TheHoleTag              = '-'
+	v8UndefinedTag            = '_'
+	v8NullTag                 = '0'
+	v8TrueTag                 = 'T'
+	v8FalseTag                = 'F'
+	v8Int32Tag                = 'I'
+	v8Uint32Tag               = 'U'
+	v8DoubleTag               = 'N'
+	v8BigIntTag               = 'Z'
+	v8Utf8StringTag           = 'S'
+	v8OneByteStringTag        = '"'
+	v8TwoByteStringTag        = 'c'
+	v8ObjectReferenceTag      = '^'
+	v8BeginJSObjectTag        = 'o'
+	v8EndJSObjectTag          = '{'
+	v8BeginSparseJSArrayTag   = 'a'
+	v8EndSparseJSArrayTag     = '@'
+	v8BeginDenseJSArrayTag    = 'A'
+	v8EndDenseJSArrayTag      = '$'
+	v8DateTag                 = 'D'
+	v8TrueObjectTag           = 'y'
+	v8FalseObjectTag          = 'x'
+	v8NumberObjectTag         = 'n'
+	v8BigIntObjectTag         = 'z'
+	v8StringObjectTag         = 's'
+	v8RegExpTag               = 'R'
+	v8BeginJSMapTag           = ';'
+	v8EndJSMapTag             = ':'
+	v8BeginJSSetTag           = '\''
+	v8EndJSSetTag             = ','
+	v8ArrayBufferTag          = 'B'
+	v8ResizableArrayBufferTag = '~'
+	v8ArrayBufferViewTag      = 'V'
+	v8ErrorTag                = 'r'
+	v8HostObjectTag           = '\\'
+)
+
+const (
+	v8ErrorEvalPrototype      = 'E'
+	v8ErrorRangePrototype     = 'R'
+	v8ErrorReferencePrototype = 'F'
+	v8ErrorSyntaxPrototype    = 'S'
+	v8ErrorTypePrototype      = 'T'
+	v8ErrorUriPrototype       = 'U'
+	v8ErrorMessage            = 'm'
+	v8ErrorCause              = 'c'
+	v8ErrorStack              = 's'
+	v8ErrorEnd                = '.'
+)
+
+const (
+	blinkBlobIndexTag = 'i'
+	blinkFileIndexTag = 'e'
+)
+
+var errUnexpectedEnd = errors.New("unexpected end of data")
+
+// Object represents a JavaScript object. Properties are kept in insertion order.
+type Object []Property
+
+// Property represents a property of a JavaScript object.
+type Property struct {
+	Key   string
+	Value any
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (o Object) MarshalJSON() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.WriteByte('{')
+	for i, prop := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(prop.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(prop.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Map represents a JavaScript Map as a list of key-value pairs.
+type Map [][2]any
+
+// RegExp represents a JavaScript RegExp.
+type RegExp struct {
+	Pattern, Flags string
+}
+
+func (r RegExp) String() string {
+	return "/" + r.Pattern + "/" + r.Flags
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r RegExp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// Reference represents a back-reference to an object that contains itself.
+type Reference uint32
+
+// MarshalJSON implements the json.Marshaler interface.
+func (r Reference) MarshalJSON() ([]byte, error) {
+	return []byte(`{"$ref":` + strconv.FormatUint(uint64(r), 10) + `}`), nil
+}
+
+type v8Deserializer struct {
+	data    []byte
+	pos     int
+	version uint64
+	nextId  uint32
+	objects map[uint32]any
+}
+
+func (d *v8Deserializer) errorf(format string, args ...any) error {
+	return fmt.Errorf("v8: offset %d: %s", d.pos, fmt.Sprintf(format, args...))
+}
+
+func (d *v8Deserializer) readByte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errUnexpectedEnd
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *v8Deserializer) readBytes(n uint64) ([]byte, error) {
+	if uint64(len(d.data)-d.pos) < n {
+		return nil, errUnexpectedEnd
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func (d *v8Deserializer) readVarint() (uint64, error) {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n <= 0 {
+		return 0, errUnexpectedEnd
+	}
+	d.pos += n
+	return v, nil
+}
+
+func (d *v8Deserializer) readZigZag() (int64, error) {
+	v, err := d.readVarint()
+	if err != nil {
+		return 0, err
+	}
+	return int64(v>>1) ^ -int64(v&1), nil
+}
+
+func (d *v8Deserializer) readDouble() (float64, error) {
+	b, err := d.readBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+}
+
+func (d *v8Deserializer) peekTag() (byte, error) {
+	for d.pos < len(d.data) && d.data[d.pos] == v8PaddingTag {
+		d.pos++
+	}
+	if d.pos >= len(d.data) {
+		return 0, errUnexpectedEnd
+	}
+	return d.data[d.pos], nil
+}
+
+func (d *v8Deserializer) readTag() (byte, error) {
+	tag, err := d.peekTag()
+	if err != nil {
+		return 0, err
+	}
+	d.pos++
+	return tag, nil
+}
+
+func (d *v8Deserializer) readHeader() error {
+	if tag, err := d.peekTag(); err != nil {
+		return err
+	} else if tag != v8VersionTag {
+		return nil
+	}
+	d.pos++
+	version, err := d.readVarint()
+	if err != nil {
+		return err
+	}
+	d.version = version
+	return nil
+}
+
+func (d *v8Deserializer) readString(tag byte) (string, error) {
+	length, err := d.readVarint()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.readBytes(length)
+	if err != nil {
+		return "", err
+	}
+
+	switch tag {
+	case v8Utf8StringTag:
+		return string(b), nil
+	case v8OneByteStringTag:
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes), nil
+	case v8TwoByteStringTag:
+		if len(b)%2 != 0 {
+			return "", d.errorf("odd two-byte string length")
+		}
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = binary.LittleEndian.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(units)), nil
+	default:
+		return "", d.errorf("unexpected tag %q", tag)
+	}
+}
+
+func (d *v8Deserializer) readStringObject() (string, error) {
+	tag, err := d.readTag()
+	if err != nil {
+		return "", err
+	}
+	return d.readString(tag)
+}
+
+func (d *v8Deserializer) readBigInt() (*big.Int, error) {
+	bitfield, err := d.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	digits, err := d.readBytes(bitfield >> 1)
+	if err != nil {
+		return nil, err
+	}
+	be := make([]byte, len(digits))
+	for i, c := range digits {
+		be[len(digits)-1-i] = c
+	}
+	v := new(big.Int).SetBytes(be)
+	if bitfield&1 != 0 {
+		v.Neg(v)
+	}
+	return v, nil
+}
+
+func (d *v8Deserializer) number(v float64) any {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "Infinity"
+	case math.IsInf(v, -1):
+		return "-Infinity"
+	default:
+		return v
+	}
+}
+
+func (d *v8Deserializer) propertyKey(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	default:
+		return "", d.errorf("invalid property key %T", v)
+	}
+}
+
+func (d *v8Deserializer) readProperties(endTag byte) (Object, error) {
+	obj := Object{}
+	for {
+		tag, err := d.peekTag()
+		if err != nil {
+			return nil, err
+		}
+		if tag == endTag {
+			d.pos++
+			return obj, nil
+		}
+		k, err := d.readObject()
+		if err != nil {
+			return nil, err
+		}
+		key, err := d.propertyKey(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.readObject()
+		if err != nil {
+			return nil, err
+		}
+		obj = append(obj, Property{key, value})
+	}
+}
+
+func (d *v8Deserializer) beginObject() uint32 {
+	id := d.nextId
+	d.nextId++
+	d.objects[id] = Reference(id)
+	return id
+}
+
+func (d *v8Deserializer) endObject(id uint32, v any) any {
+	d.objects[id] = v
+	return v
+}
+
+func (d *v8Deserializer) arrayFromProperties(length uint64, props Object) any {
+	if length > uint64(len(d.data)) {
+		return props
+	}
+	arr := make([]any, length)
+	for _, prop := range props {
+		i, err := strconv.ParseUint(prop.Key, 10, 64)
+		if err == nil && i < length {
+			arr[i] = prop.Value
+		}
+	}
+	return arr
+}
+
+func (d *v8Deserializer) readArrayBufferView(buffer []byte) (any, error) {
+	id := d.beginObject()
+	subtag, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	offset, err := d.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	length, err := d.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	if d.version >= 14 {
+		if _, err := d.readVarint(); err != nil {
+			return nil, err
+		}
+	}
+	if offset > uint64(len(buffer)) || length > uint64(len(buffer))-offset {
+		return nil, d.errorf("array buffer view out of range")
+	}
+	b := buffer[offset : offset+length]
+
+	var view any
+	switch subtag {
+	case 'b':
+		view = typedArray(b, 1, func(b []byte) any { return int8(b[0]) })
+	case 'B', 'C':
+		view = typedArray(b, 1, func(b []byte) any { return int(b[0]) })
+	case 'w':
+		view = typedArray(b, 2, func(b []byte) any { return int16(binary.LittleEndian.Uint16(b)) })
+	case 'W':
+		view = typedArray(b, 2, func(b []byte) any { return binary.LittleEndian.Uint16(b) })
+	case 'd':
+		view = typedArray(b, 4, func(b []byte) any { return int32(binary.LittleEndian.Uint32(b)) })
+	case 'D':
+		view = typedArray(b, 4, func(b []byte) any { return binary.LittleEndian.Uint32(b) })
+	case 'f':
+		view = typedArray(b, 4, func(b []byte) any {
+			return d.number(float64(math.Float32frombits(binary.LittleEndian.Uint32(b))))
+		})
+	case 'F':
+		view = typedArray(b, 8, func(b []byte) any {
+			return d.number(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		})
+	case 'q':
+		view = typedArray(b, 8, func(b []byte) any {
+			return big.NewInt(int64(binary.LittleEndian.Uint64(b)))
+		})
+	case 'Q':
+		view = typedArray(b, 8, func(b []byte) any {
+			return new(big.Int).SetUint64(binary.LittleEndian.Uint64(b))
+		})
+	case '?':
+		view = b
+	default:
+		return nil, d.errorf("unsupported array buffer view type %q", subtag)
+	}
+	return d.endObject(id, view), nil
+}
+
+func typedArray(b []byte, size int, elem func([]byte) any) []any {
+	arr := make([]any, len(b)/size)
+	for i := range arr {
+		arr[i] = elem(b[i*size:])
+	}
+	return arr
+}
+
+func (d *v8Deserializer) readError() (any, error) {
+	id := d.beginObject()
+	obj := Object{{"name", "Error"}}
+	for {
+		tag, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case v8ErrorEvalPrototype:
+			obj[0].Value = "EvalError"
+		case v8ErrorRangePrototype:
+			obj[0].Value = "RangeError"
+		case v8ErrorReferencePrototype:
+			obj[0].Value = "ReferenceError"
+		case v8ErrorSyntaxPrototype:
+			obj[0].Value = "SyntaxError"
+		case v8ErrorTypePrototype:
+			obj[0].Value = "TypeError"
+		case v8ErrorUriPrototype:
+			obj[0].Value = "URIError"
+		case v8ErrorMessage:
+			message, err := d.readStringObject()
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, Property{"message", message})
+		case v8ErrorStack:
+			stack, err := d.readStringObject()
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, Property{"stack", stack})
+		case v8ErrorCause:
+			cause, err := d.readObject()
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, Property{"cause", cause})
+		case v8ErrorEnd:
+			return d.endObject(id, obj), nil
+		default:
+			return nil, d.errorf("unknown error tag %q", rune(tag))
+		}
+	}
+}
+
+func (d *v8Deserializer) readHostObject() (any, error) {
+	id := d.beginObject()
+	tag, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case blinkBlobIndexTag:
+		index, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		return d.endObject(id, Object{{"$blobIndex", index}}), nil
+	case blinkFileIndexTag:
+		index, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		return d.endObject(id, Object{{"$fileIndex", index}}), nil
+	default:
+		return nil, d.errorf("unsupported host object tag %q", tag)
+	}
+}
+
+func (d *v8Deserializer) readObject() (any, error) {
+	v, err := d.readObjectInternal()
+	if err != nil {
+		return nil, err
+	}
+	if buffer, ok := v.([]byte); ok {
+		if tag, err := d.peekTag(); err == nil && tag == v8ArrayBufferViewTag {
+			d.pos++
+			return d.readArrayBufferView(buffer)
+		}
+	}
+	return v, nil
+}
+
+func (d *v8Deserializer) readObjectInternal() (any, error) {
+	tag, err := d.readTag()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case v8VerifyObjectCountTag:
+		if _, err := d.readVarint(); err != nil {
+			return nil, err
+		}
+		return d.readObject()
+	case v8UndefinedTag, v8NullTag, v8TheHoleTag:
+		return nil, nil
+	case v8TrueTag:
+		return true, nil
+	case v8FalseTag:
+		return false, nil
+	case v8Int32Tag:
+		v, err := d.readZigZag()
+		if err != nil {
+			return nil, err
+		}
+		return int64(int32(v)), nil
+	case v8Uint32Tag:
+		v, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		return int64(uint32(v)), nil
+	case v8DoubleTag:
+		v, err := d.readDouble()
+		if err != nil {
+			return nil, err
+		}
+		return d.number(v), nil
+	case v8BigIntTag:
+		return d.readBigInt()
+	case v8Utf8StringTag, v8OneByteStringTag, v8TwoByteStringTag:
+		return d.readString(tag)
+	case v8ObjectReferenceTag:
+		id, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		v, ok := d.objects[uint32(id)]
+		if !ok {
+			return nil, d.errorf("invalid object reference %d", id)
+		}
+		return v, nil
+	case v8BeginJSObjectTag:
+		id := d.beginObject()
+		obj, err := d.readProperties(v8EndJSObjectTag)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := d.readVarint(); err != nil {
+			return nil, err
+		}
+		return d.endObject(id, obj), nil
+	case v8BeginSparseJSArrayTag:
+		id := d.beginObject()
+		if _, err := d.readVarint(); err != nil {
+			return nil, err
+		}
+		props, err := d.readProperties(v8EndSparseJSArrayTag)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := d.readVarint(); err != nil {
+			return nil, err
+		}
+		length, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		return d.endObject(id, d.arrayFromProperties(length, props)), nil
+	case v8BeginDenseJSArrayTag:
+		id := d.beginObject()
+		length, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		if length > uint64(len(d.data)) {
+			return nil, d.errorf("invalid array length %d", length)
+		}
+		arr := make([]any, length)
+		for i := range arr {
+			if arr[i], err = d.readObject(); err != nil {
+				return nil, err
+			}
+		}
+		props, err := d.readProperties(v8EndDenseJSArrayTag)
+		if err != nil {
+			return nil, err
+		}
+		for _, prop := range props {
+			i, err := strconv.ParseUint(prop.Key, 10, 64)
+			if err == nil && i < length {
+				arr[i] = prop.Value
+			}
+		}
+		if _, err := d.readVarint(); err != nil {
+			return nil, err
+		}
+		if _, err := d.readVarint(); err != nil {
+			return nil, err
+		}
+		return d.endObject(id, arr), nil
+	case v8DateTag:
+		id := d.beginObject()
+		v, err := d.readDouble()
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(v) {
+			return d.endObject(id, "Invalid Date"), nil
+		}
+		return d.endObject(id, Date(v)), nil
+	case v8TrueObjectTag:
+		return d.endObject(d.beginObject(), true), nil
+	case v8FalseObjectTag:
+		return d.endObject(d.beginObject(), false), nil
+	case v8NumberObjectTag:
+		id := d.beginObject()
+		v, err := d.readDouble()
+		if err != nil {
+			return nil, err
+		}
+		return d.endObject(id, d.number(v)), nil
+	case v8BigIntObjectTag:
+		id := d.beginObject()
+		v, err := d.readBigInt()
+		if err != nil {
+			return nil, err
+		}
+		return d.endObject(id, v), nil
+	case v8StringObjectTag:
+		id := d.beginObject()
+		v, err := d.readStringObject()
+		if err != nil {
+			return nil, err
+		}
+		return d.endObject(id, v), nil
+	case v8RegExpTag:
+		id := d.beginObject()
+		pattern, err := d.readStringObject()
+		if err != nil {
+			return nil, err
+		}
+		flags, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		return d.endObject(id, RegExp{pattern, regExpFlags(flags)}), nil
+	case v8BeginJSMapTag:
+		id := d.beginObject()
+		m := Map{}
+		for {
+			tag, err := d.peekTag()
+			if err != nil {
+				return nil, err
+			}
+			if tag == v8EndJSMapTag {
+				d.pos++
+				break
+			}
+			key, err := d.readObject()
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.readObject()
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, [2]any{key, value})
+		}
+		if _, err := d.readVarint(); err != nil {
+			return nil, err
+		}
+		return d.endObject(id, m), nil
+	case v8BeginJSSetTag:
+		id := d.beginObject()
+		set := []any{}
+		for {
+			tag, err := d.peekTag()
+			if err != nil {
+				return nil, err
+			}
+			if tag == v8EndJSSetTag {
+				d.pos++
+				break
+			}
+			v, err := d.readObject()
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, v)
+		}
+		if _, err := d.readVarint(); err != nil {
+			return nil, err
+		}
+		return d.endObject(id, set), nil
+	case v8ArrayBufferTag:
+		id := d.beginObject()
+		length, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.readBytes(length)
+		if err != nil {
+			return nil, err
+		}
+		return d.endObject(id, b), nil
+	case v8ResizableArrayBufferTag:
+		id := d.beginObject()
+		length, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := d.readVarint(); err != nil {
+			return nil, err
+		}
+		b, err := d.readBytes(length)
+		if err != nil {
+			return nil, err
+		}
+		return d.endObject(id, b), nil
+	case v8ErrorTag:
+		return d.readError()
+	case v8HostObjectTag:
+		return d.readHostObject()
+	default:
+		return nil, d.errorf("unsupported tag %q", tag)
+	}
+}
+
+func regExpFlags(flags uint64) string {
+	// Bit positions of JSRegExp::Flags, listed in the canonical flag order.
+	chars := []struct {
+		bit  uint64
+		flag byte
+	}{
+		{1 << 7, 'd'},
+		{1 << 0, 'g'},
+		{1 << 1, 'i'},
+		{1 << 6, 'l'},
+		{1 << 2, 'm'},
+		{1 << 5, 's'},
+		{1 << 4, 'u'},
+		{1 << 8, 'v'},
+		{1 << 3, 'y'},
+	}
+	var s []byte
+	for _, c := range chars {
+		if flags&c.bit != 0 {
+			s = append(s, c.flag)
+		}
+	}
+	return string(s)
+}
+
+// DeserializeV8 decodes data serialized by V8's ValueSerializer.
+func DeserializeV8(b []byte) (any, error) {
+	d := &v8Deserializer{data: b, objects: make(map[uint32]any)}
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+	return d.readObject()
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package indexeddb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/golang/snappy"
+)
+
+// References:
+//   https://source.chromium.org/chromium/chromium/src/+/main:third_party/blink/renderer/bindings/core/v8/serialization/serialized_script_value.cc
+//   https://source.chromium.org/chromium/chromium/src/+/main:third_party/blink/renderer/modules/indexeddb/idb_value_wrapping.cc
+
+const (
+	blinkVersionTag       = 0xff
+	blinkTrailerOffsetTag = 0xfe
+
+	// Values wrapped by IDBValueWrapper start with the version tag followed
+	// by this pseudo version.
+	requiresProcessingSSVPseudoVersion = 0x11
+	replaceWithBlob                    = 0x01
+	compressedWithSnappy               = 0x02
+)
+
+// ErrExternalValue is returned when a value is stored in an external blob
+// file instead of the database.
+var ErrExternalValue = errors.New("value is stored in an external blob")
+
+// DecodeValue decodes a value of an object store record, which consists of
+// a varint-encoded version followed by a Blink SerializedScriptValue.
+func DecodeValue(b []byte) (any, error) {
+	_, n := binary.Uvarint(b)
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid record version")
+	}
+	return DecodeSerializedScriptValue(b[n:])
+}
+
+// DecodeSerializedScriptValue decodes a value serialized by Blink's
+// SerializedScriptValue, possibly wrapped by IDBValueWrapper.
+func DecodeSerializedScriptValue(b []byte) (any, error) {
+	if len(b) >= 3 && b[0] == blinkVersionTag && b[1] == requiresProcessingSSVPseudoVersion {
+		switch b[2] {
+		case replaceWithBlob:
+			return nil, ErrExternalValue
+		case compressedWithSnappy:
+			decoded, err := snappy.Decode(nil, b[3:])
+			if err != nil {
+				return nil, err
+			}
+			b = decoded
+		default:
+			return nil, fmt.Errorf("unknown value wrapping %#02x", b[2])
+		}
+	}
+
+	if len(b) > 0 && b[0] == blinkVersionTag {
+		_, n := binary.Uvarint(b[1:])
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid Blink version")
+		}
+		b = b[1+n:]
+
+		if len(b) > 0 && b[0] == blinkTrailerOffsetTag {
+			// Trailer offset (uint64) and size (uint32).
+			if len(b) < 13 {
+				return nil, errUnexpectedEnd
+			}
+			b = b[13:]
+		}
+	}
+
+	return DeserializeV8(b)
+}
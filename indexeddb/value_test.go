@@ -0,0 +1,107 @@
+// Copyright (c) 2021-2024 cions
+// Licensed under the MIT License. See LICENSE for details.
+
+package indexeddb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+func TestDeserializeV8(t *testing.T) {
+	cases := []struct {
+		Input, Want string
+	}{
+		{"ff0f 5f", `null`},
+		{"ff0f 54", `true`},
+		{"ff0f 49 54", `42`},
+		{"ff0f 49 53", `-42`},
+		{"ff0f 4e 000000000000f83f", `1.5`},
+		{"ff0f 4e 000000000000f87f", `"NaN"`},
+		{"ff0f 5a 10 0100000000000000", `1`},
+		{"ff0f 5a 11 0100000000000000", `-1`},
+		{"ff0f 22 03 616263", `"abc"`},
+		{"ff0f 22 01 e9", `"é"`},
+		{"ff0f 00 63 04 3d d8 00 de", `"😀"`},
+		{"ff0f 6f 22 01 61 49 02 22 01 62 22 01 78 7b 02", `{"a":1,"b":"x"}`},
+		{"ff0f 6f 49 02 54 7b 01", `{"1":true}`},
+		{"ff0f 41 02 49 02 2d 24 00 02", `[1,null]`},
+		{"ff0f 61 03 49 02 22 01 78 40 01 03", `[null,"x",null]`},
+		{"ff0f 44 0000000000000000", `"1970-01-01T00:00:00.000Z"`},
+		{"ff0f 52 22 02 6162 03", `"/ab/gi"`},
+		{"ff0f 3b 49 02 22 01 78 3a 02", `[[1,"x"]]`},
+		{"ff0f 27 49 02 49 04 2c 02", `[1,2]`},
+		{"ff0f 42 02 0102", `"AQI="`},
+		{"ff0f 42 02 0102 56 42 00 02 00", `[1,2]`},
+		{"ff0f 42 04 01000200 56 57 00 04 00", `[1,2]`},
+		{"ff0f 79", `true`},
+		{"ff0f 73 22 01 78", `"x"`},
+		{"ff0f 6f 22 01 61 6f 7b 00 22 01 62 5e 01 7b 02", `{"a":{},"b":{}}`},
+		{"ff0f 6f 22 04 73656c66 5e 00 7b 01", `{"self":{"$ref":0}}`},
+		{"ff0f 72 54 6d 22 01 78 2e", `{"name":"TypeError","message":"x"}`},
+		{"ff0f 5c 69 03", `{"$blobIndex":3}`},
+	}
+
+	for _, tc := range cases {
+		v, err := DeserializeV8(decodeHex(tc.Input))
+		if err != nil {
+			t.Errorf("DeserializeV8(%s): unexpected error: %v", tc.Input, err)
+			continue
+		}
+		got, err := json.Marshal(v)
+		if err != nil {
+			t.Errorf("DeserializeV8(%s): json.Marshal: %v", tc.Input, err)
+		} else if string(got) != tc.Want {
+			t.Errorf("DeserializeV8(%s) = %s, want %s", tc.Input, got, tc.Want)
+		}
+	}
+
+	invalids := []string{
+		"",
+		"ff0f",
+		"ff0f 22 05 61",
+		"ff0f 6f 22 01 61",
+		"ff0f 5e 00",
+		"ff0f 01",
+	}
+
+	for _, input := range invalids {
+		if _, err := DeserializeV8(decodeHex(input)); err == nil {
+			t.Errorf("DeserializeV8(%s) should fail", input)
+		}
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	ssv := decodeHex("ff15 fe 0000000000000000 00000000 ff0f 6f 22 01 61 49 02 7b 01")
+	compressed := append(decodeHex("ff11 02"), snappy.Encode(nil, ssv)...)
+
+	cases := []struct {
+		Input []byte
+		Want  string
+	}{
+		{append([]byte{0x01}, ssv...), `{"a":1}`},
+		{append([]byte{0x01}, compressed...), `{"a":1}`},
+		{decodeHex("01 ff0e ff0d 22 01 78"), `"x"`},
+	}
+
+	for _, tc := range cases {
+		v, err := DecodeValue(tc.Input)
+		if err != nil {
+			t.Errorf("DecodeValue(%x): unexpected error: %v", tc.Input, err)
+			continue
+		}
+		got, err := json.Marshal(v)
+		if err != nil {
+			t.Errorf("DecodeValue(%x): json.Marshal: %v", tc.Input, err)
+		} else if string(got) != tc.Want {
+			t.Errorf("DecodeValue(%x) = %s, want %s", tc.Input, got, tc.Want)
+		}
+	}
+
+	if _, err := DecodeValue(decodeHex("01 ff11 01 0a 00")); err != ErrExternalValue {
+		t.Errorf("DecodeValue(blob-wrapped value) = %v, want ErrExternalValue", err)
+	}
+}